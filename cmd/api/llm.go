@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/shunpei/rulegate/internal/llm"
+)
+
+// llmConfig collects the environment settings needed to build the LLM backends.
+type llmConfig struct {
+	backend      string
+	projectID    string
+	region       string
+	model        string
+	rewriteModel string
+
+	openAIBaseURL      string
+	openAIAPIKey       string
+	openAIModel        string
+	openAIRewriteModel string
+	openAIJSONMode     bool
+
+	rewriteChain string
+	answerChain  string
+	fallbackOn   string
+
+	contextBudgets llm.TokenBudgets
+
+	contextCache bool
+	cacheConfig  llm.CacheConfig
+	glossary     string
+}
+
+// buildLLM assembles the per-stage fallback chains.
+//
+// Chain entries are comma-separated: "local" selects the OpenAI-compatible
+// backend with OPENAI_MODEL, "openai:<model>" selects it with an explicit
+// model, and "gemini:<model>" or a bare model name selects Gemini.
+func buildLLM(ctx context.Context, cfg llmConfig, prompts *llm.PromptStore) (llm.LLM, error) {
+	fallOn := llm.DefaultFallbackOn
+	if cfg.fallbackOn != "" {
+		classes, err := llm.ParseErrorClasses(cfg.fallbackOn)
+		if err != nil {
+			return nil, fmt.Errorf("LLM_FALLBACK_ON: %w", err)
+		}
+		fallOn = classes
+	}
+
+	rewriteSpec, answerSpec := cfg.rewriteChain, cfg.answerChain
+	switch cfg.backend {
+	case "gemini":
+		if rewriteSpec == "" {
+			rewriteSpec = cfg.rewriteModel
+		}
+		if answerSpec == "" {
+			answerSpec = cfg.model
+		}
+	case "openai":
+		if rewriteSpec == "" {
+			rewriteSpec = "local"
+		}
+		if answerSpec == "" {
+			answerSpec = "local"
+		}
+	default:
+		return nil, fmt.Errorf("unknown LLM_BACKEND %q (want gemini or openai)", cfg.backend)
+	}
+
+	b := &backendBuilder{ctx: ctx, cfg: cfg, prompts: prompts}
+	rewrite, err := b.chain(rewriteSpec)
+	if err != nil {
+		return nil, fmt.Errorf("rewrite chain: %w", err)
+	}
+	answer, err := b.chain(answerSpec)
+	if err != nil {
+		return nil, fmt.Errorf("answer chain: %w", err)
+	}
+	return llm.NewFallbackLLM(rewrite, answer, fallOn)
+}
+
+// backendBuilder lazily creates the underlying clients so that a chain without
+// Gemini entries never needs Vertex credentials.
+type backendBuilder struct {
+	ctx     context.Context
+	cfg     llmConfig
+	prompts *llm.PromptStore
+
+	gemini *llm.GeminiClient
+	local  *llm.OpenAIClient
+}
+
+func (b *backendBuilder) chain(spec string) ([]llm.Backend, error) {
+	var backends []llm.Backend
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		client, err := b.backend(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry, err)
+		}
+		backends = append(backends, llm.Backend{Name: entry, LLM: client})
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("empty chain")
+	}
+	return backends, nil
+}
+
+func (b *backendBuilder) backend(entry string) (llm.LLM, error) {
+	kind, model, ok := strings.Cut(entry, ":")
+	if !ok {
+		kind, model = "gemini", entry
+		if entry == "local" {
+			kind, model = "local", ""
+		}
+	}
+
+	switch kind {
+	case "gemini":
+		if b.gemini == nil {
+			c, err := llm.NewGeminiClient(b.ctx, b.cfg.projectID, b.cfg.region, b.cfg.model, b.cfg.rewriteModel, b.prompts)
+			if err != nil {
+				return nil, err
+			}
+			c.SetContextBudgets(b.cfg.contextBudgets)
+			c.SetGlossary(b.cfg.glossary)
+			if b.cfg.contextCache {
+				c.EnableContextCache(b.cfg.cacheConfig)
+			}
+			b.gemini = c
+		}
+		return b.gemini.WithModels(model, model), nil
+	case "local":
+		if b.local == nil {
+			c, err := llm.NewOpenAIClient(b.cfg.openAIBaseURL, b.cfg.openAIAPIKey, b.cfg.openAIModel, b.cfg.openAIRewriteModel, b.cfg.openAIJSONMode, b.prompts)
+			if err != nil {
+				return nil, err
+			}
+			c.SetContextBudgets(b.cfg.contextBudgets)
+			b.local = c
+		}
+		return b.local, nil
+	case "openai":
+		c, err := llm.NewOpenAIClient(b.cfg.openAIBaseURL, b.cfg.openAIAPIKey, model, model, b.cfg.openAIJSONMode, b.prompts)
+		if err != nil {
+			return nil, err
+		}
+		c.SetContextBudgets(b.cfg.contextBudgets)
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown backend kind %q", kind)
+}
@@ -10,6 +10,12 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/shunpei/rulegate/internal/answercache"
+	"github.com/shunpei/rulegate/internal/cassette"
+	"github.com/shunpei/rulegate/internal/conversation"
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/feedback"
+	"github.com/shunpei/rulegate/internal/guard"
 	apphttp "github.com/shunpei/rulegate/internal/http"
 	"github.com/shunpei/rulegate/internal/llm"
 	"github.com/shunpei/rulegate/internal/logging"
@@ -39,13 +45,92 @@ func run() error {
 	allowOrigin := envOrDefault("ALLOW_ORIGIN", "*")
 	port := envOrDefault("PORT", "8080")
 	promptsPath := envOrDefault("PROMPTS_PATH", "docs/prompts.md")
+	promptsWatchInterval := envOrDefaultDuration("PROMPTS_WATCH_INTERVAL", 0)
+	adminToken := envOrDefault("ADMIN_TOKEN", "")
+	openAIModel := envOrDefault("OPENAI_MODEL", "")
+	contextBudgets, err := llm.ParseTokenBudgets(
+		envOrDefaultInt("CONTEXT_TOKEN_BUDGET", 12000),
+		envOrDefault("CONTEXT_TOKEN_BUDGETS", ""),
+	)
+	if err != nil {
+		return fmt.Errorf("CONTEXT_TOKEN_BUDGETS: %w", err)
+	}
+	glossary := ""
+	if path := envOrDefault("GEMINI_GLOSSARY_PATH", ""); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("GEMINI_GLOSSARY_PATH: %w", err)
+		}
+		glossary = string(b)
+	}
+	llmCfg := llmConfig{
+		backend:            envOrDefault("LLM_BACKEND", "gemini"),
+		projectID:          projectID,
+		region:             region,
+		model:              model,
+		rewriteModel:       rewriteModel,
+		openAIBaseURL:      envOrDefault("OPENAI_BASE_URL", "http://localhost:11434/v1"),
+		openAIAPIKey:       envOrDefault("OPENAI_API_KEY", ""),
+		openAIModel:        openAIModel,
+		openAIRewriteModel: envOrDefault("OPENAI_REWRITE_MODEL", openAIModel),
+		openAIJSONMode:     envOrDefaultBool("OPENAI_JSON_MODE", true),
+		rewriteChain:       envOrDefault("LLM_REWRITE_CHAIN", ""),
+		answerChain:        envOrDefault("LLM_ANSWER_CHAIN", ""),
+		fallbackOn:         envOrDefault("LLM_FALLBACK_ON", ""),
+		contextBudgets:     contextBudgets,
+		contextCache:       envOrDefaultBool("GEMINI_CONTEXT_CACHE", false),
+		cacheConfig: llm.CacheConfig{
+			TTL:       envOrDefaultDuration("GEMINI_CACHE_TTL", llm.DefaultCacheTTL),
+			MinTokens: envOrDefaultInt("GEMINI_CACHE_MIN_TOKENS", llm.DefaultCacheMinTokens),
+		},
+		glossary: glossary,
+	}
 
 	defaultTopK := envOrDefaultInt("TOP_K_DEFAULT", 8)
 	defaultMinConf := envOrDefaultFloat("MIN_CONFIDENCE_DEFAULT", 0.55)
 	rateLimitRPS := envOrDefaultFloat("RATE_LIMIT_RPS", 10.0)
 	rateLimitBurst := envOrDefaultInt("RATE_LIMIT_BURST", 20)
+	exposeUsage := envOrDefaultBool("EXPOSE_USAGE", false)
+	injectionMode := envOrDefault("INJECTION_MODE", "neutralize")
+	injectionClassifier := envOrDefaultBool("INJECTION_CLASSIFIER", false)
+	decompose := envOrDefaultBool("QUESTION_DECOMPOSITION", false)
+	conversationStore := envOrDefault("CONVERSATION_STORE", "")
+	conversationOpts := conversation.Options{
+		TTL:      envOrDefaultDuration("CONVERSATION_TTL", conversation.DefaultTTL),
+		MaxTurns: envOrDefaultInt("CONVERSATION_MAX_TURNS", conversation.DefaultMaxTurns),
+	}
+	answerCacheEnabled := envOrDefaultBool("ANSWER_CACHE", false)
+	answerCacheOpts := answercache.Options{
+		TTL:                 envOrDefaultDuration("ANSWER_CACHE_TTL", answercache.DefaultTTL),
+		MaxEntries:          envOrDefaultInt("ANSWER_CACHE_MAX_ENTRIES", answercache.DefaultMaxEntries),
+		MaxBytes:            envOrDefaultInt("ANSWER_CACHE_MAX_BYTES", answercache.DefaultMaxBytes),
+		CorpusCheckInterval: envOrDefaultDuration("ANSWER_CACHE_CORPUS_CHECK_INTERVAL", answercache.DefaultCorpusCheckInterval),
+		Similarity:          envOrDefaultFloat("ANSWER_CACHE_SIMILARITY", answercache.DefaultSimilarity),
+	}
+	answerCacheSemantic := envOrDefault("ANSWER_CACHE_SEMANTIC", "")
+	batchMaxQuestions := envOrDefaultInt("BATCH_MAX_QUESTIONS", domain.DefaultBatchMaxQuestions)
+	batchConcurrency := envOrDefaultInt("BATCH_CONCURRENCY", apphttp.DefaultBatchConcurrency)
+	retrievalMode, err := domain.ParseRetrievalMode(envOrDefault("RETRIEVAL_MODE", string(domain.RetrievalQuery)))
+	if err != nil {
+		return fmt.Errorf("RETRIEVAL_MODE: %w", err)
+	}
+	scoreMetric, err := rag.ParseScoreMetric(envOrDefault("RETRIEVAL_SCORE_METRIC", string(rag.MetricSimilarity)))
+	if err != nil {
+		return fmt.Errorf("RETRIEVAL_SCORE_METRIC: %w", err)
+	}
+
+	prices, err := llm.ParsePriceTable(envOrDefault("LLM_PRICES", ""))
+	if err != nil {
+		return fmt.Errorf("LLM_PRICES: %w", err)
+	}
+
+	cassetteRecord := envOrDefault("CASSETTE_RECORD", "")
+	cassetteReplay := envOrDefault("CASSETTE_REPLAY", "")
+	if cassetteRecord != "" && cassetteReplay != "" {
+		return fmt.Errorf("CASSETTE_RECORD and CASSETTE_REPLAY are mutually exclusive")
+	}
 
-	if projectID == "" {
+	if projectID == "" && cassetteReplay == "" {
 		return fmt.Errorf("GCP_PROJECT_ID is required")
 	}
 	if ragCorpusID == "" {
@@ -53,34 +138,206 @@ func run() error {
 	}
 
 	// Load prompt templates.
-	prompts, err := llm.LoadPrompts(promptsPath)
+	experiment, err := llm.ParseExperiment(envOrDefault("PROMPT_VARIANTS", ""))
+	if err != nil {
+		return fmt.Errorf("PROMPT_VARIANTS: %w", err)
+	}
+	prompts, err := llm.NewPromptStore(promptsPath, experiment)
 	if err != nil {
 		return fmt.Errorf("load prompts: %w", err)
 	}
-	slog.Info("prompts loaded", "path", promptsPath)
+	slog.Info("prompts loaded", "path", promptsPath, "version", prompts.Current().Version, "experiment", experiment != nil)
+	if promptsWatchInterval > 0 {
+		go prompts.Watch(ctx, promptsWatchInterval)
+	}
+	go reloadPromptsOnSIGHUP(ctx, prompts)
+	if retrievalMode.UsesHyDE() && prompts.Current().RewriteHyDEUser == nil {
+		return fmt.Errorf("RETRIEVAL_MODE=%s: query_rewrite_hyde_user section missing from %s", retrievalMode, promptsPath)
+	}
+	if pt := prompts.Current(); decompose && (pt.DecomposeSystem == "" || pt.DecomposeUser == nil || pt.AnswerSynthesisUser == nil) {
+		return fmt.Errorf("QUESTION_DECOMPOSITION: question_decompose_* or answer_synthesis_user sections missing from %s", promptsPath)
+	}
+	if conversationStore != "" && prompts.Current().RewriteFollowUpUser == nil {
+		return fmt.Errorf("CONVERSATION_STORE: query_rewrite_followup_user section missing from %s", promptsPath)
+	}
 
-	// Initialize RAG client.
-	ragClient, err := rag.NewVertexRAGClient(ctx, projectID, region)
-	if err != nil {
-		return fmt.Errorf("init rag client: %w", err)
+	// Conversation history for follow-up questions.
+	var conversations conversation.Store
+	switch conversationStore {
+	case "":
+	case "memory":
+		conversations = conversation.NewMemoryStore(conversationOpts)
+	case "sqlite":
+		path := envOrDefault("CONVERSATION_SQLITE_PATH", "conversations.db")
+		s, err := conversation.OpenSQLite(path, conversationOpts)
+		if err != nil {
+			return fmt.Errorf("CONVERSATION_STORE=sqlite: %w", err)
+		}
+		conversations = s
+	default:
+		return fmt.Errorf("unknown CONVERSATION_STORE %q (want memory or sqlite)", conversationStore)
+	}
+	if conversations != nil {
+		defer conversations.Close()
+		slog.Info("conversations enabled", "store", conversationStore, "ttl", conversationOpts.TTL, "max_turns", conversationOpts.MaxTurns)
 	}
-	defer ragClient.Close()
 
-	// Initialize LLM client.
-	llmClient, err := llm.NewGeminiClient(ctx, projectID, region, model, rewriteModel, prompts)
-	if err != nil {
-		return fmt.Errorf("init llm client: %w", err)
+	// Answer feedback (POST /api/feedback).
+	var feedbackStore feedback.Store
+	switch store := envOrDefault("FEEDBACK_STORE", ""); store {
+	case "":
+	case "jsonl":
+		path := envOrDefault("FEEDBACK_PATH", "feedback.jsonl")
+		s, err := feedback.OpenJSONL(path)
+		if err != nil {
+			return fmt.Errorf("FEEDBACK_STORE=jsonl: %w", err)
+		}
+		feedbackStore = s
+		slog.Info("feedback enabled", "store", store, "path", path)
+	case "sqlite":
+		path := envOrDefault("FEEDBACK_PATH", "feedback.db")
+		s, err := feedback.OpenSQLite(path)
+		if err != nil {
+			return fmt.Errorf("FEEDBACK_STORE=sqlite: %w", err)
+		}
+		feedbackStore = s
+		slog.Info("feedback enabled", "store", store, "path", path)
+	default:
+		return fmt.Errorf("unknown FEEDBACK_STORE %q (want jsonl or sqlite)", store)
+	}
+	if feedbackStore != nil {
+		defer feedbackStore.Close()
+	}
+
+	var (
+		ragClient rag.Retriever
+		llmClient llm.LLM
+	)
+	if cassetteReplay != "" {
+		// Serve recorded calls only; no Vertex or local model is contacted.
+		c, err := cassette.Load(cassetteReplay)
+		if err != nil {
+			return fmt.Errorf("CASSETTE_REPLAY: %w", err)
+		}
+		ragClient, llmClient = c.Retriever(), c.LLM()
+		slog.Warn("replaying cassette; llm and retriever calls are served from the file", "path", cassetteReplay)
+	} else {
+		// Initialize RAG client.
+		vertexRAG, err := rag.NewVertexRAGClient(ctx, projectID, region)
+		if err != nil {
+			return fmt.Errorf("init rag client: %w", err)
+		}
+		ragClient = vertexRAG
+
+		// Initialize LLM client (per-stage fallback chains).
+		llmClient, err = buildLLM(ctx, llmCfg, prompts)
+		if err != nil {
+			return fmt.Errorf("init llm client: %w", err)
+		}
+		slog.Info("llm backend ready", "backend", llmCfg.backend)
+	}
+	if cassetteRecord != "" {
+		rec, err := cassette.NewRecorder(cassetteRecord)
+		if err != nil {
+			return fmt.Errorf("CASSETTE_RECORD: %w", err)
+		}
+		defer rec.Close()
+		ragClient, llmClient = rec.WrapRetriever(ragClient), rec.WrapLLM(llmClient)
+		slog.Warn("recording llm and retriever calls to cassette", "path", cassetteRecord)
 	}
+	defer ragClient.Close()
 	defer llmClient.Close()
 
+	// Prompt injection screening.
+	var detector *guard.Detector
+	if injectionMode != "off" {
+		mode, err := guard.ParseMode(injectionMode)
+		if err != nil {
+			return fmt.Errorf("INJECTION_MODE: %w", err)
+		}
+		var classifier guard.Classifier
+		if injectionClassifier {
+			c, ok := llmClient.(guard.Classifier)
+			if !ok {
+				return fmt.Errorf("INJECTION_CLASSIFIER: llm backend does not support classification")
+			}
+			if pt := prompts.Current(); pt.InjectionSystem == "" || pt.InjectionUser == nil {
+				return fmt.Errorf("INJECTION_CLASSIFIER: injection_classifier_* sections missing from %s", promptsPath)
+			}
+			classifier = c
+		}
+		detector = guard.NewDetector(mode, classifier)
+		slog.Info("injection screening enabled", "mode", string(mode), "classifier", injectionClassifier)
+	}
+
+	// Answer cache. Corpus changes are detected when the retriever can
+	// report corpus versions; otherwise entries only expire.
+	var answerCache *answercache.Cache
+	if answerCacheEnabled {
+		switch answerCacheSemantic {
+		case "":
+		case "vertex":
+			if projectID == "" {
+				return fmt.Errorf("ANSWER_CACHE_SEMANTIC=vertex: GCP_PROJECT_ID is required")
+			}
+			embedder, err := llm.NewVertexEmbedder(ctx, projectID, region,
+				envOrDefault("ANSWER_CACHE_EMBEDDING_MODEL", llm.DefaultEmbeddingModel))
+			if err != nil {
+				return fmt.Errorf("ANSWER_CACHE_SEMANTIC=vertex: %w", err)
+			}
+			answerCacheOpts.Embedder = embedder
+		case "hash":
+			answerCacheOpts.Embedder = answercache.HashEmbedder{}
+		default:
+			return fmt.Errorf("unknown ANSWER_CACHE_SEMANTIC %q (want vertex or hash)", answerCacheSemantic)
+		}
+		versioner, _ := ragClient.(rag.CorpusVersioner)
+		answerCache = answercache.New(answerCacheOpts, versioner)
+		slog.Info("answer cache enabled", "ttl", answerCacheOpts.TTL, "max_entries", answerCacheOpts.MaxEntries,
+			"max_bytes", answerCacheOpts.MaxBytes, "corpus_versions", versioner != nil,
+			"semantic", answerCacheSemantic, "similarity", answerCacheOpts.Similarity)
+	}
+
 	// Build handler and router.
 	handler := apphttp.NewHandler(ragClient, llmClient, apphttp.Config{
 		DefaultTopK:    defaultTopK,
 		DefaultMinConf: defaultMinConf,
 		SourceURL:      sourceURL,
 		RAGCorpusID:    ragCorpusID,
+		Prices:         prices,
+		ExposeUsage:    exposeUsage,
+		Injection:      detector,
+		Prompts:        prompts,
+		AdminToken:     adminToken,
+		RetrievalMode:  retrievalMode,
+		ScoreMetric:    scoreMetric,
+		Decompose:      decompose,
+		Conversations:  conversations,
+		Feedback:       feedbackStore,
+		AnswerCache:    answerCache,
+
+		BatchMaxQuestions: batchMaxQuestions,
+		BatchConcurrency:  batchConcurrency,
+		ReadyCacheTTL:     envOrDefaultDuration("READY_CACHE_TTL", apphttp.DefaultReadyCacheTTL),
+		ReadyTimeout:      envOrDefaultDuration("READY_TIMEOUT", apphttp.DefaultReadyTimeout),
+		MaxBodyBytes:      int64(envOrDefaultInt("MAX_BODY_BYTES", apphttp.DefaultMaxBodyBytes)),
 	})
 
+	// Warm up the backends (one trivial call each) before accepting traffic.
+	// A failure does not stop startup: /readyz reports it until it recovers.
+	warmStart := time.Now()
+	if ready := handler.WarmUp(ctx); ready.Status == domain.HealthUnavailable {
+		slog.Error("warm-up failed; /readyz reports unavailable", "checks", ready.Checks)
+	} else {
+		slog.Info("warm-up done", "status", string(ready.Status), "duration_ms", time.Since(warmStart).Milliseconds())
+	}
+
+	// Batches cost one rate limit token per question; questions beyond the
+	// burst wait for their tokens, up to apphttp.MaxRateLimitWait.
+	if wait := time.Duration(float64(batchMaxQuestions-rateLimitBurst) / rateLimitRPS * float64(time.Second)); wait > apphttp.MaxRateLimitWait {
+		slog.Warn("the largest batches cannot get their rate limit tokens in time and are always rate limited",
+			"batch_max_questions", batchMaxQuestions, "rate_limit_rps", rateLimitRPS, "rate_limit_burst", rateLimitBurst)
+	}
 	rateLimiter := apphttp.NewIPRateLimiter(rateLimitRPS, rateLimitBurst)
 	e := apphttp.NewRouter(handler, rateLimiter, allowOrigin)
 
@@ -112,6 +369,26 @@ func run() error {
 	return nil
 }
 
+// reloadPromptsOnSIGHUP reloads the prompt file each time the process receives SIGHUP.
+func reloadPromptsOnSIGHUP(ctx context.Context, prompts *llm.PromptStore) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			changed, err := prompts.Reload()
+			if err != nil {
+				slog.Error("prompt reload failed; keeping current prompts", "error", err)
+				continue
+			}
+			slog.Info("prompts reloaded", "trigger", "SIGHUP", "version", prompts.Current().Version, "changed", changed)
+		}
+	}
+}
+
 func envOrDefault(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -128,6 +405,24 @@ func envOrDefaultInt(key string, fallback int) int {
 	return fallback
 }
 
+func envOrDefaultBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func envOrDefaultDuration(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
 func envOrDefaultFloat(key string, fallback float64) float64 {
 	if v := os.Getenv(key); v != "" {
 		if f, err := strconv.ParseFloat(v, 64); err == nil {
@@ -0,0 +1,8 @@
+//go:build cgo
+
+package main
+
+// SQLite-backed stores (CONVERSATION_STORE=sqlite, FEEDBACK_STORE=sqlite)
+// need the cgo driver; binaries built with CGO_ENABLED=0 report it as
+// unavailable at startup.
+import _ "github.com/mattn/go-sqlite3"
@@ -5,7 +5,7 @@ const API_URL = process.env.API_URL || "http://localhost:8080";
 export async function POST(request: NextRequest) {
   const body = await request.text();
 
-  const res = await fetch(`${API_URL}/api/ask`, {
+  const res = await fetch(`${API_URL}/api/v2/ask`, {
     method: "POST",
     headers: { "Content-Type": "application/json" },
     body,
@@ -27,7 +27,7 @@ export function AnswerCard({ question, response }: AnswerCardProps) {
       </CardHeader>
       <CardContent className="space-y-4">
         <div className="prose prose-sm max-w-none prose-headings:text-base prose-headings:font-semibold prose-headings:mt-4 prose-headings:mb-2 prose-p:my-1.5 prose-ul:my-1.5 prose-ol:my-1.5 prose-li:my-0.5">
-          <ReactMarkdown>{response.answer_ja}</ReactMarkdown>
+          <ReactMarkdown>{response.answer}</ReactMarkdown>
         </div>
         {!isNotFound && <CitationList citations={response.citations} />}
       </CardContent>
@@ -1,29 +1,75 @@
+// Mirrors the /api/v2, /api/feedback and /readyz schemas served at
+// /api/openapi.json (generated from internal/domain). internal/openapi's
+// tests fail when the interfaces here and the schema disagree on field names
+// or optionality.
+
+export type Language = "ja" | "en" | "ko";
+
+export type RetrievalMode = "query" | "hyde" | "hyde_fused";
+
 export interface AskRequest {
-  question_ja: string;
+  question?: string;
+  language?: Language;
+  /** Legacy Japanese-only field; mutually exclusive with question. */
+  question_ja?: string;
   discipline?: string;
   rule_edition?: string;
   context?: QueryContext;
   options?: RequestOption;
+  /** Set on the follow-up to a ClarificationResponse. */
+  clarification?: ClarificationReply;
+  /** Continues the conversation of an earlier response. */
+  conversation_id?: string;
 }
 
 export interface QueryContext {
   boat_class?: string;
   race_phase?: string;
+  event_type?: string;
   notes?: string;
 }
 
+export interface ClarificationReply {
+  choices: QueryContext[];
+}
+
 export interface RequestOption {
   top_k?: number;
   min_confidence?: number;
   return_contexts?: boolean;
   answer_style?: string;
+  retrieval_mode?: RetrievalMode;
+  decompose?: boolean;
+  allow_clarification?: boolean;
+  /** Returns a pipeline trace; requires the admin token as a Bearer token. */
+  debug?: boolean;
 }
 
 export interface AskResponse {
-  answer_ja: string;
+  answer: string;
+  language: Language;
+  /** Present only when language is "ja". */
+  answer_ja?: string;
   confidence: number;
   citations: Citation[];
+  /** Present when conversations are enabled on the server. */
+  conversation_id?: string;
+  /** Present when options.return_contexts is set. */
+  contexts?: ContextExcerpt[];
   meta: Meta;
+  debug?: Trace;
+}
+
+export interface ContextExcerpt {
+  rule_id?: string;
+  section_title?: string;
+  source_uri?: string;
+  score: number;
+  /** Clipped to 25 words, like citation quotes. */
+  excerpt: string;
+  /** Whether the context was given to the answer model. */
+  passed_gate: boolean;
+  sub_question?: number;
 }
 
 export interface Citation {
@@ -32,16 +78,211 @@ export interface Citation {
   quote_en: string;
   source_url: string;
   score: number;
+  /** 1-based index into meta.sub_questions; absent when not decomposed. */
+  sub_question?: number;
 }
 
 export interface Meta {
   rag_corpus: string;
   top_k: number;
   warnings: string[];
+  rewrite_model?: string;
+  answer_model?: string;
+  sub_questions?: string[];
+  /** Send these back with feedback on the answer. */
+  prompt_version?: string;
+  prompt_variant?: string;
+  /** Present only when the server exposes usage. */
+  usage?: UsageSummary;
+}
+
+export interface Usage {
+  model: string;
+  prompt_tokens: number;
+  candidate_tokens: number;
+  cached_tokens: number;
+  thoughts_tokens: number;
+}
+
+export interface PromptSize {
+  system_chars: number;
+  user_chars: number;
+}
+
+export interface UsageSummary {
+  prompt_tokens: number;
+  candidate_tokens: number;
+  cached_tokens: number;
+  thoughts_tokens: number;
+  estimated_cost_usd: number;
+}
+
+/** Returned instead of an AskResponse when options.allow_clarification is set. */
+export interface ClarificationResponse {
+  clarification: Clarification;
+  question: string;
+  language: Language;
+  conversation_id?: string;
+  meta: Meta;
+  debug?: Trace;
+}
+
+export interface Clarification {
+  question: string;
+  field: string;
+  options: ClarificationOption[];
+}
+
+export interface ClarificationOption {
+  label: string;
+  context: QueryContext;
+}
+
+export interface BatchAskRequest {
+  questions: BatchQuestion[];
+  language?: Language;
+  discipline?: string;
+  rule_edition?: string;
+  context?: QueryContext;
+  options?: RequestOption;
+}
+
+export interface BatchQuestion {
+  /** Optional label echoed in the result. */
+  id?: string;
+  question: string;
+  /** Overrides the shared context. */
+  context?: QueryContext;
+}
+
+export interface BatchAskResponse {
+  results: BatchItemResult[];
+  meta: BatchMeta;
+}
+
+/** Exactly one of response, clarification and error is set. */
+export interface BatchItemResult {
+  index: number;
+  id?: string;
+  request_id: string;
+  status: number;
+  response?: AskResponse;
+  clarification?: ClarificationResponse;
+  error?: ErrorResponse;
+}
+
+export interface BatchMeta {
+  total: number;
+  succeeded: number;
+  failed: number;
+  usage?: UsageSummary;
+}
+
+/** Pipeline trace of a debug request; not a stable contract. */
+export interface Trace {
+  request_id: string;
+  prompt_version?: string;
+  prompt_variant?: string;
+  retrieval_mode: RetrievalMode;
+  top_k: number;
+  history_turns?: number;
+  stages: StageTrace[];
+  parts: PartTrace[];
+  gate?: GateTrace;
+  usage: UsageSummary;
+  retrieve_ms: number;
+  total_ms: number;
+}
+
+export interface StageTrace {
+  stage: string;
+  model?: string;
+  usage?: Usage;
+  prompt?: PromptSize;
+  duration_ms: number;
+  error?: string;
+}
+
+export interface PartTrace {
+  question: string;
+  rewrite: RewriteTrace;
+  retrievals: RetrievalTrace[];
+  retrieve_ms: number;
+  contexts: ScoredContext[];
+  max_score: number;
+  passed_gate: boolean;
+}
+
+export interface RewriteTrace {
+  q_en: string;
+  keywords_en?: string[];
+  q_ja?: string;
+  hypothetical_passage_en?: string;
+  standalone_question?: string;
+  model?: string;
+  usage?: Usage;
+  prompt?: PromptSize;
+  duration_ms: number;
+}
+
+export interface RetrievalTrace {
+  query: string;
+  results: ScoredContext[];
+}
+
+export interface ScoredContext {
+  rule_id?: string;
+  section_title?: string;
+  source_uri?: string;
+  /** As returned by the retriever. */
+  raw_score: number;
+  /** Calibrated to [0, 1]; the gate compares this with min_confidence. */
+  score: number;
+}
+
+export interface GateTrace {
+  threshold: number;
+  max_score: number;
+  passed: boolean;
+}
+
+export type FeedbackRating = "helpful" | "wrong" | "incomplete";
+
+export interface FeedbackRequest {
+  /** X-Request-ID header of the rated answer. */
+  request_id: string;
+  rating: FeedbackRating;
+  comment?: string;
+  /** The rule the answer should have cited, if known. */
+  correct_rule_id?: string;
+  /** Copied from the rated answer's meta; the current prompts are assumed without them. */
+  prompt_version?: string;
+  prompt_variant?: string;
+}
+
+export interface FeedbackResponse {
+  status: string;
+}
+
+export type HealthStatus = "ok" | "degraded" | "unavailable";
+
+/** GET /readyz; status is the worst of the checks. */
+export interface ReadinessResponse {
+  status: HealthStatus;
+  checks: Record<string, DependencyStatus>;
+}
+
+export interface DependencyStatus {
+  status: HealthStatus;
+  error?: string;
+  latency_ms: number;
+  /** Prompt version in use (prompts check only). */
+  version?: string;
 }
 
 export interface ErrorResponse {
   error: string;
   code?: string;
+  /** For schema errors, the offending field, e.g. "options.top_k: expected integer, got string". */
   details?: string;
 }
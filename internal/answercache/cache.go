@@ -0,0 +1,366 @@
+// Package answercache caches pipeline results so repeated questions are
+// answered without calling the retriever or the models again.
+package answercache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/rag"
+)
+
+const (
+	// DefaultTTL is how long an answer is served after it was generated.
+	DefaultTTL = time.Hour
+	// DefaultMaxEntries bounds the number of cached answers.
+	DefaultMaxEntries = 1000
+	// DefaultMaxBytes bounds the total JSON size of cached answers.
+	DefaultMaxBytes = 32 << 20
+	// DefaultCorpusCheckInterval is how long a corpus version is trusted
+	// before the retriever is asked again.
+	DefaultCorpusCheckInterval = 5 * time.Minute
+	// DefaultSimilarity is the semantic match threshold.
+	DefaultSimilarity = 0.9
+)
+
+// Options configures a Cache.
+type Options struct {
+	// TTL <= 0 means DefaultTTL.
+	TTL time.Duration
+	// MaxEntries <= 0 means DefaultMaxEntries.
+	MaxEntries int
+	// MaxBytes <= 0 means DefaultMaxBytes.
+	MaxBytes int
+	// CorpusCheckInterval <= 0 means DefaultCorpusCheckInterval.
+	CorpusCheckInterval time.Duration
+	// Embedder enables semantic matching: a question without an exact
+	// entry is answered from the most similar cached question of the same
+	// scope that mentions the same boat classes and numbers. nil disables it.
+	Embedder Embedder
+	// Similarity is the minimum cosine similarity of a semantic match;
+	// <= 0 means DefaultSimilarity.
+	Similarity float64
+}
+
+func (o Options) withDefaults() Options {
+	if o.TTL <= 0 {
+		o.TTL = DefaultTTL
+	}
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = DefaultMaxEntries
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultMaxBytes
+	}
+	if o.CorpusCheckInterval <= 0 {
+		o.CorpusCheckInterval = DefaultCorpusCheckInterval
+	}
+	if o.Similarity <= 0 {
+		o.Similarity = DefaultSimilarity
+	}
+	return o
+}
+
+// Scope is everything besides the question that an answer depends on.
+// Callers fill in effective values (defaults applied), so a request that
+// spells out a default shares entries with one that omits it.
+type Scope struct {
+	Corpus             string                     `json:"corpus"`
+	PromptVersion      string                     `json:"prompt_version"`
+	PromptVariant      string                     `json:"prompt_variant"`
+	Language           domain.Language            `json:"language"`
+	Context            *domain.QueryContext       `json:"context"`
+	Clarification      *domain.ClarificationReply `json:"clarification"`
+	TopK               int                        `json:"top_k"`
+	MinConfidence      float64                    `json:"min_confidence"`
+	RetrievalMode      domain.RetrievalMode       `json:"retrieval_mode"`
+	Decompose          bool                       `json:"decompose"`
+	AllowClarification bool                       `json:"allow_clarification"`
+	ReturnContexts     bool                       `json:"return_contexts"`
+	AnswerStyle        string                     `json:"answer_style"`
+}
+
+// Key identifies a cache entry.
+type Key struct {
+	// Scope is a hash of the Scope, including the corpus version.
+	Scope string
+	// Question is the normalized question.
+	Question string
+
+	asked string
+	// entities are the question's digit-bearing tokens; see questionEntities.
+	entities string
+	// emb is the question's embedding, computed on first use and shared by
+	// copies of the key so a miss and the following Put embed only once.
+	emb *embedding
+}
+
+type embedding struct {
+	once sync.Once
+	vec  []float32
+	err  error
+}
+
+func (k Key) String() string {
+	sum := sha256.Sum256([]byte(k.Scope + "\x00" + k.Question))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Hit is a cached pipeline result. Exactly one of Response and
+// Clarification is set; both are fresh copies the caller may modify.
+type Hit struct {
+	Response      *domain.AskResponse
+	Clarification *domain.ClarificationResponse
+	// ETag identifies the cached content within its key (question, scope,
+	// corpus and prompt versions); it changes when any of them changes.
+	ETag    string
+	Expires time.Time
+	// Question is the question the entry was generated for, as asked, and
+	// Similarity its similarity to the looked-up question (1 for exact
+	// matches).
+	Question   string
+	Similarity float64
+}
+
+// Cache is an in-memory LRU of pipeline results with a TTL. Entries are
+// keyed by the prompt version and the corpus version among others, so
+// reloading prompts or changing the corpus makes older entries unreachable;
+// they are evicted as the cache fills or expire.
+type Cache struct {
+	opts    Options
+	corpora rag.CorpusVersioner
+	now     func() time.Time
+
+	mu       sync.Mutex
+	lru      *list.List // of *entry, most recently used first
+	entries  map[string]*list.Element
+	bytes    int
+	versions map[string]corpusVersion
+}
+
+type entry struct {
+	key           string
+	scope         string
+	question      string
+	entities      string
+	vec           []float32
+	response      []byte
+	clarification []byte
+	etag          string
+	expires       time.Time
+}
+
+type corpusVersion struct {
+	version string
+	err     error
+	checked time.Time
+}
+
+// New creates a cache. corpora may be nil, in which case corpus changes are
+// only picked up as entries expire.
+func New(opts Options, corpora rag.CorpusVersioner) *Cache {
+	return &Cache{
+		opts:     opts.withDefaults(),
+		corpora:  corpora,
+		now:      time.Now,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		versions: map[string]corpusVersion{},
+	}
+}
+
+// Key returns the key of question within scope. It fails when the corpus
+// version cannot be determined; the request should then bypass the cache
+// rather than risk an answer from a stale corpus.
+func (c *Cache) Key(ctx context.Context, scope Scope, question string) (Key, error) {
+	v, err := c.corpusVersion(ctx, scope.Corpus)
+	if err != nil {
+		return Key{}, err
+	}
+	b, err := json.Marshal(struct {
+		Scope
+		CorpusVersion string `json:"corpus_version"`
+	}{scope, v})
+	if err != nil {
+		return Key{}, err
+	}
+	sum := sha256.Sum256(b)
+	normalized := NormalizeQuestion(question)
+	return Key{
+		Scope:    hex.EncodeToString(sum[:16]),
+		Question: normalized,
+		asked:    question,
+		entities: questionEntities(normalized),
+		emb:      &embedding{},
+	}, nil
+}
+
+// embed returns the embedding of the key's question, or nil when semantic
+// matching is off or embedding failed.
+func (c *Cache) embed(ctx context.Context, key Key) []float32 {
+	if c.opts.Embedder == nil || key.emb == nil {
+		return nil
+	}
+	key.emb.once.Do(func() {
+		key.emb.vec, key.emb.err = c.opts.Embedder.Embed(ctx, key.Question)
+		if key.emb.err != nil {
+			slog.WarnContext(ctx, "answer cache: embedding failed; semantic matching skipped", "error", key.emb.err)
+		}
+	})
+	return key.emb.vec
+}
+
+// corpusVersion returns the corpus version, asking the retriever at most
+// once per CorpusCheckInterval. Failures are remembered as long.
+func (c *Cache) corpusVersion(ctx context.Context, corpus string) (string, error) {
+	if c.corpora == nil {
+		return "", nil
+	}
+	now := c.now()
+	c.mu.Lock()
+	cv, ok := c.versions[corpus]
+	c.mu.Unlock()
+	if ok && now.Sub(cv.checked) < c.opts.CorpusCheckInterval {
+		return cv.version, cv.err
+	}
+
+	v, err := c.corpora.CorpusVersion(ctx, corpus)
+	if err != nil {
+		err = fmt.Errorf("corpus version: %w", err)
+	}
+	if err == nil && ok && cv.err == nil && v != cv.version {
+		slog.InfoContext(ctx, "answer cache: corpus changed", "corpus", corpus, "version", v, "previous", cv.version)
+	}
+	c.mu.Lock()
+	c.versions[corpus] = corpusVersion{version: v, err: err, checked: now}
+	c.mu.Unlock()
+	return v, err
+}
+
+// Get returns the entry for key if present and not expired. Failing that,
+// with an Embedder configured, it returns the most similar entry of the same
+// scope and the same question entities (boat classes, gate and rule numbers)
+// above the similarity threshold.
+func (c *Cache) Get(ctx context.Context, key Key) (*Hit, bool) {
+	c.mu.Lock()
+	el, ok := c.entries[key.String()]
+	if ok && !c.now().Before(el.Value.(*entry).expires) {
+		c.remove(el)
+		ok = false
+	}
+	c.mu.Unlock()
+	similarity := 1.0
+	if !ok {
+		vec := c.embed(ctx, key)
+		if vec == nil {
+			return nil, false
+		}
+		el, similarity = c.similar(key, vec)
+		if el == nil {
+			return nil, false
+		}
+	}
+
+	c.mu.Lock()
+	e := el.Value.(*entry)
+	if c.entries[e.key] == el {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+
+	hit := &Hit{ETag: e.etag, Expires: e.expires, Question: e.question, Similarity: similarity}
+	var err error
+	if e.response != nil {
+		err = json.Unmarshal(e.response, &hit.Response)
+	} else {
+		err = json.Unmarshal(e.clarification, &hit.Clarification)
+	}
+	if err != nil {
+		return nil, false
+	}
+	return hit, true
+}
+
+// similar returns the live entry of key's scope and entities whose question
+// embedding is most similar to vec, if any reaches the threshold.
+func (c *Cache) similar(key Key, vec []float32) (*list.Element, float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	var best *list.Element
+	bestSim := c.opts.Similarity
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*entry)
+		if e.scope != key.Scope || e.entities != key.entities || e.vec == nil || !now.Before(e.expires) {
+			continue
+		}
+		if sim := cosine(vec, e.vec); sim >= bestSim {
+			best, bestSim = el, sim
+		}
+	}
+	return best, bestSim
+}
+
+// Put stores a result under key, replacing any earlier entry, and returns
+// the stored entry's ETag and expiry. Results larger than MaxBytes are not
+// stored (the returned ETag is then empty).
+func (c *Cache) Put(ctx context.Context, key Key, resp *domain.AskResponse, clarification *domain.ClarificationResponse) (etag string, expires time.Time, err error) {
+	e := &entry{key: key.String(), scope: key.Scope, question: key.asked, entities: key.entities, vec: c.embed(ctx, key)}
+	var body []byte
+	if resp != nil {
+		body, err = json.Marshal(resp)
+		e.response = body
+	} else {
+		body, err = json.Marshal(clarification)
+		e.clarification = body
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if e.size() > c.opts.MaxBytes {
+		return "", time.Time{}, nil
+	}
+	// The key covers the scope, including the corpus and prompt versions, so
+	// the ETag changes with them even when the answer text does not.
+	sum := sha256.Sum256([]byte(e.key + "\x00" + string(body)))
+	e.etag = hex.EncodeToString(sum[:8])
+	e.expires = c.now().Add(c.opts.TTL)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.bytes += e.size()
+	for c.lru.Len() > c.opts.MaxEntries || c.bytes > c.opts.MaxBytes {
+		c.remove(c.lru.Back())
+	}
+	return e.etag, e.expires, nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// remove deletes an entry; c.mu must be held.
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.bytes -= e.size()
+}
+
+func (e *entry) size() int {
+	return len(e.response) + len(e.clarification) + len(e.question) + 4*len(e.vec)
+}
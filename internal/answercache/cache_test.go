@@ -0,0 +1,231 @@
+package answercache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+func TestNormalizeQuestion(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"ゲート接触のペナルティは？", "ゲート接触のペナルティは"},
+		{"  ゲート接触の ペナルティは?", "ゲート接触のペナルティは"},
+		{"ｋ１の　ゲート不通過は何秒？", "k1のゲート不通過は何秒"},
+		{"What is the  penalty for a gate touch?", "what is the penalty for a gate touch"},
+		{"Rule 29.5, please!", "rule 29 5 please"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeQuestion(tt.in); got != tt.want {
+			t.Errorf("NormalizeQuestion(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+type stubVersioner struct {
+	version string
+	err     error
+	calls   int
+}
+
+func (s *stubVersioner) CorpusVersion(_ context.Context, _ string) (string, error) {
+	s.calls++
+	return s.version, s.err
+}
+
+func answer(text string) *domain.AskResponse {
+	return domain.NewAskResponse(domain.LangJA, text)
+}
+
+func TestCache_GetPut(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	c := New(Options{TTL: time.Minute}, nil)
+	c.now = func() time.Time { return now }
+
+	key, err := c.Key(ctx, Scope{Corpus: "c", TopK: 8}, "ゲート接触は？")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(ctx, key); ok {
+		t.Fatal("unexpected hit on an empty cache")
+	}
+	etag, expires, err := c.Put(ctx, key, answer("2秒"), nil)
+	if err != nil || etag == "" || !expires.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Put: etag=%q expires=%v err=%v", etag, expires, err)
+	}
+
+	same, _ := c.Key(ctx, Scope{Corpus: "c", TopK: 8}, "ゲート接触は?")
+	hit, ok := c.Get(ctx, same)
+	if !ok || hit.Response.Answer != "2秒" || hit.ETag != etag {
+		t.Fatalf("expected a hit with the stored answer, got %+v", hit)
+	}
+	hit.Response.Answer = "changed"
+	if again, _ := c.Get(ctx, same); again.Response.Answer != "2秒" {
+		t.Error("hits must not share state with the cache")
+	}
+
+	other, _ := c.Key(ctx, Scope{Corpus: "c", TopK: 5}, "ゲート接触は？")
+	if _, ok := c.Get(ctx, other); ok {
+		t.Error("a different scope must miss")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get(ctx, key); ok || c.Len() != 0 {
+		t.Error("expired entries must miss and be evicted")
+	}
+}
+
+func TestCache_Bounds(t *testing.T) {
+	ctx := context.Background()
+	c := New(Options{MaxEntries: 2}, nil)
+	keys := make([]Key, 3)
+	for i, q := range []string{"a", "b", "c"} {
+		keys[i], _ = c.Key(ctx, Scope{}, q)
+	}
+	c.Put(ctx, keys[0], answer("a"), nil)
+	c.Put(ctx, keys[1], answer("b"), nil)
+	c.Get(ctx, keys[0])
+	c.Put(ctx, keys[2], answer("c"), nil)
+	if _, ok := c.Get(ctx, keys[1]); ok {
+		t.Error("the least recently used entry should have been evicted")
+	}
+	if _, ok := c.Get(ctx, keys[0]); !ok {
+		t.Error("a recently read entry should have been kept")
+	}
+
+	small := New(Options{MaxBytes: 200}, nil)
+	etag, _, err := small.Put(ctx, keys[0], answer(strings.Repeat("x", 500)), nil)
+	if err != nil || etag != "" || small.Len() != 0 {
+		t.Errorf("oversized entries must not be stored: etag=%q err=%v len=%d", etag, err, small.Len())
+	}
+}
+
+func TestCache_CorpusVersion(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	corpora := &stubVersioner{version: "v1"}
+	c := New(Options{CorpusCheckInterval: time.Minute}, corpora)
+	c.now = func() time.Time { return now }
+
+	first, _ := c.Key(ctx, Scope{Corpus: "c"}, "q")
+	corpora.version = "v2"
+	if again, _ := c.Key(ctx, Scope{Corpus: "c"}, "q"); again.String() != first.String() || corpora.calls != 1 {
+		t.Errorf("the version should be reused within the check interval (calls=%d)", corpora.calls)
+	}
+
+	now = now.Add(time.Minute)
+	if changed, _ := c.Key(ctx, Scope{Corpus: "c"}, "q"); changed.String() == first.String() {
+		t.Error("a new corpus version must change the key")
+	}
+
+	now = now.Add(time.Minute)
+	corpora.err = errors.New("unavailable")
+	if _, err := c.Key(ctx, Scope{Corpus: "c"}, "q"); err == nil {
+		t.Error("expected an error when the corpus version is unknown")
+	}
+	if _, err := c.Key(ctx, Scope{Corpus: "c"}, "q"); err == nil || corpora.calls != 3 {
+		t.Errorf("failures should be remembered for the check interval (calls=%d)", corpora.calls)
+	}
+}
+
+// countingEmbedder counts calls to a HashEmbedder.
+type countingEmbedder struct {
+	HashEmbedder
+	calls int
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	e.calls++
+	return e.HashEmbedder.Embed(ctx, text)
+}
+
+func TestCache_SemanticMatch(t *testing.T) {
+	ctx := context.Background()
+	embedder := &countingEmbedder{}
+	c := New(Options{Embedder: embedder, Similarity: 0.6}, nil)
+
+	stored, _ := c.Key(ctx, Scope{Corpus: "c"}, "ゲートに触ったら何秒のペナルティ？")
+	if _, ok := c.Get(ctx, stored); ok {
+		t.Fatal("unexpected hit on an empty cache")
+	}
+	c.Put(ctx, stored, answer("2秒"), nil)
+	if embedder.calls != 1 {
+		t.Errorf("a miss and its Put should embed once, got %d calls", embedder.calls)
+	}
+
+	paraphrase, _ := c.Key(ctx, Scope{Corpus: "c"}, "ゲートに触れたら何秒のペナルティ？")
+	hit, ok := c.Get(ctx, paraphrase)
+	if !ok || hit.Response.Answer != "2秒" || hit.Similarity >= 1 || hit.Question != "ゲートに触ったら何秒のペナルティ？" {
+		t.Fatalf("expected a semantic hit, got %+v", hit)
+	}
+
+	otherCorpus, _ := c.Key(ctx, Scope{Corpus: "d"}, "ゲートに触れたら何秒のペナルティ？")
+	if _, ok := c.Get(ctx, otherCorpus); ok {
+		t.Error("semantic matches must stay within the scope")
+	}
+	unrelated, _ := c.Key(ctx, Scope{Corpus: "c"}, "スタート時刻の変更手続き")
+	if _, ok := c.Get(ctx, unrelated); ok {
+		t.Error("an unrelated question must miss")
+	}
+}
+
+func TestHashEmbedder(t *testing.T) {
+	ctx := context.Background()
+	e := HashEmbedder{}
+	a, _ := e.Embed(ctx, "ゲート接触のペナルティ")
+	b, _ := e.Embed(ctx, "ゲート接触のペナルティ")
+	c, _ := e.Embed(ctx, "what is the start procedure")
+	if len(a) != DefaultHashDimensions || cosine(a, b) < 0.999 {
+		t.Errorf("identical texts should embed identically (similarity %f)", cosine(a, b))
+	}
+	if sim := cosine(a, c); sim > 0.3 {
+		t.Errorf("unrelated texts are too similar: %f", sim)
+	}
+}
+
+func TestCache_SemanticMatchRequiresSameEntities(t *testing.T) {
+	ctx := context.Background()
+	c := New(Options{Embedder: HashEmbedder{}, Similarity: 0.6}, nil)
+
+	k1, _ := c.Key(ctx, Scope{Corpus: "c"}, "K1でゲートに触ったら何秒のペナルティ？")
+	c.Put(ctx, k1, answer("K1: 2秒"), nil)
+
+	c1, _ := c.Key(ctx, Scope{Corpus: "c"}, "C1でゲートに触ったら何秒のペナルティ？")
+	vk1, _ := HashEmbedder{}.Embed(ctx, k1.Question)
+	vc1, _ := HashEmbedder{}.Embed(ctx, c1.Question)
+	if sim := cosine(vk1, vc1); sim < 0.6 {
+		t.Fatalf("the test needs questions above the threshold, got %f", sim)
+	}
+	if hit, ok := c.Get(ctx, c1); ok {
+		t.Errorf("a question about another boat class must miss, got %q", hit.Response.Answer)
+	}
+
+	gate5, _ := c.Key(ctx, Scope{Corpus: "c"}, "K1 ゲート5に触ったら何秒？")
+	c.Put(ctx, gate5, answer("gate 5"), nil)
+	gate6, _ := c.Key(ctx, Scope{Corpus: "c"}, "K1 ゲート6に触ったら何秒？")
+	if hit, ok := c.Get(ctx, gate6); ok {
+		t.Errorf("a question about another gate must miss, got %q", hit.Response.Answer)
+	}
+
+	paraphrase, _ := c.Key(ctx, Scope{Corpus: "c"}, "K1でゲートに触れたら何秒のペナルティ？")
+	if hit, ok := c.Get(ctx, paraphrase); !ok || hit.Response.Answer != "K1: 2秒" {
+		t.Errorf("a paraphrase with the same boat class should hit, got %+v", hit)
+	}
+}
+
+func TestQuestionEntities(t *testing.T) {
+	for q, want := range map[string]string{
+		"K1でゲート5に触ったら？":        "5 k1",
+		"c2 と C2 の違い":          "c2",
+		"Rule 29.4 says what?": "29 4",
+		"ゲート接触のペナルティ":          "",
+	} {
+		if got := questionEntities(NormalizeQuestion(q)); got != want {
+			t.Errorf("questionEntities(%q) = %q, want %q", q, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package answercache
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+)
+
+// Embedder turns a (normalized) question into a vector for semantic
+// matching. Vectors of one Embedder must have the same length.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// DefaultHashDimensions is the vector length of a zero HashEmbedder.
+const DefaultHashDimensions = 256
+
+// HashEmbedder embeds text locally by hashing its character bigrams and
+// trigrams into a fixed number of dimensions. It captures surface overlap
+// only, not meaning, but is deterministic and needs no network, which makes
+// it suitable for tests and local development.
+type HashEmbedder struct {
+	// Dimensions <= 0 means DefaultHashDimensions.
+	Dimensions int
+}
+
+func (e HashEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	dims := e.Dimensions
+	if dims <= 0 {
+		dims = DefaultHashDimensions
+	}
+	vec := make([]float32, dims)
+	runes := []rune(text)
+	for n := 2; n <= 3; n++ {
+		for i := 0; i+n <= len(runes); i++ {
+			h := fnv.New32a()
+			h.Write([]byte(string(runes[i : i+n])))
+			sum := h.Sum32()
+			// The top bit picks the sign so collisions tend to cancel out.
+			if sum&(1<<31) != 0 {
+				vec[sum%uint32(dims)]--
+			} else {
+				vec[sum%uint32(dims)]++
+			}
+		}
+	}
+	return vec, nil
+}
+
+// cosine returns the cosine similarity of a and b, or 0 when their lengths
+// differ or either is zero.
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
@@ -0,0 +1,59 @@
+package answercache
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeQuestion folds the differences that do not change a question's
+// meaning: width and compatibility forms (NFKC), case, punctuation and
+// whitespace. Spaces are kept only between two words of a spaced script, so
+// "K1 の ゲート" and "K1のゲート" normalize alike.
+func NormalizeQuestion(q string) string {
+	var b strings.Builder
+	var prev rune
+	gap := false
+	for _, r := range norm.NFKC.String(q) {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			gap = b.Len() > 0
+			continue
+		}
+		if gap && !unspaced(prev) && !unspaced(r) {
+			b.WriteByte(' ')
+		}
+		gap = false
+		r = unicode.ToLower(r)
+		b.WriteRune(r)
+		prev = r
+	}
+	return b.String()
+}
+
+// unspaced reports whether r belongs to a script written without spaces
+// between words.
+func unspaced(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || r == 'ー'
+}
+
+// questionEntities returns the tokens of a normalized question that contain
+// a digit (boat classes such as "k1" and "c2", gate numbers, rule numbers),
+// sorted and deduplicated. Questions that differ only in these tokens embed
+// almost identically but have different answers, so a semantic match
+// requires them to be equal.
+func questionEntities(normalized string) string {
+	var tokens []string
+	// Tokens are runs of ASCII letters and digits, so "ゲート5" yields "5".
+	notToken := func(r rune) bool {
+		return !('a' <= r && r <= 'z' || unicode.IsDigit(r))
+	}
+	for _, t := range strings.FieldsFunc(normalized, notToken) {
+		if strings.IndexFunc(t, unicode.IsDigit) >= 0 {
+			tokens = append(tokens, t)
+		}
+	}
+	slices.Sort(tokens)
+	return strings.Join(slices.Compact(tokens), " ")
+}
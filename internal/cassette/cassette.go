@@ -0,0 +1,148 @@
+// Package cassette records LLM and retriever calls to a file and replays them
+// deterministically, so a production request can be turned into a handler
+// test that runs without Vertex access.
+//
+// A cassette is a JSON Lines file with one Interaction per line. Replay keys
+// each interaction by its kind and normalized input (JSON with sorted keys and
+// collapsed whitespace in strings), so cassettes can be edited by hand.
+package cassette
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/llm"
+)
+
+// Interaction kinds.
+const (
+	KindRetrieve  = "retrieve"
+	KindRewrite   = "rewrite"
+	KindAnswer    = "answer"
+	KindDecompose = "decompose"
+	KindClarify   = "clarify"
+	KindInjection = "classify_injection"
+)
+
+// Interaction is one recorded call.
+type Interaction struct {
+	Kind      string          `json:"kind"`
+	RequestID string          `json:"request_id,omitempty"`
+	Input     json.RawMessage `json:"input"`
+	Output    json.RawMessage `json:"output,omitempty"`
+	// Model, Usage and Warnings carry the result fields that are not part of
+	// the model's JSON output.
+	Model    string        `json:"model,omitempty"`
+	Usage    *domain.Usage `json:"usage,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"`
+	// Error is the call's error message; ErrorKind names the llm sentinel it
+	// wrapped, if any, so replayed errors map to the same responses.
+	Error     string `json:"error,omitempty"`
+	ErrorKind string `json:"error_kind,omitempty"`
+}
+
+// Inputs are recorded with explicit JSON names so cassettes stay readable.
+type (
+	retrieveInput struct {
+		Query  string `json:"query"`
+		Corpus string `json:"corpus"`
+		TopK   int    `json:"top_k"`
+	}
+	rewriteInput struct {
+		Question string               `json:"question"`
+		Language domain.Language      `json:"language"`
+		Context  *domain.QueryContext `json:"context,omitempty"`
+		HyDE     bool                 `json:"hyde,omitempty"`
+		History  []domain.Turn        `json:"history,omitempty"`
+	}
+	answerInput struct {
+		Question  string                    `json:"question"`
+		Language  domain.Language           `json:"language"`
+		Contexts  []domain.RetrievedContext `json:"contexts,omitempty"`
+		SourceURL string                    `json:"source_url"`
+		Parts     []llm.AnswerPart          `json:"parts,omitempty"`
+	}
+	decomposeInput struct {
+		Question string          `json:"question"`
+		Language domain.Language `json:"language"`
+	}
+	clarifyInput struct {
+		Question string               `json:"question"`
+		Language domain.Language      `json:"language"`
+		Context  *domain.QueryContext `json:"context,omitempty"`
+	}
+	injectionInput struct {
+		Text string `json:"text"`
+	}
+)
+
+func newRewriteInput(in llm.RewriteInput) rewriteInput {
+	return rewriteInput{Question: in.Question, Language: in.Language, Context: in.Context, HyDE: in.HyDE, History: in.History}
+}
+
+func newAnswerInput(in llm.AnswerInput) answerInput {
+	return answerInput{Question: in.Question, Language: in.Language, Contexts: in.Contexts, SourceURL: in.SourceURL, Parts: in.Parts}
+}
+
+// errorKinds maps the llm sentinels that change how the handler responds.
+var errorKinds = map[string]error{
+	"safety_blocked": llm.ErrSafetyBlocked,
+	"recitation":     llm.ErrRecitation,
+	"truncated":      llm.ErrTruncated,
+	"invalid_output": llm.ErrInvalidOutput,
+}
+
+func errorKind(err error) string {
+	for kind, sentinel := range errorKinds {
+		if errors.Is(err, sentinel) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// ReplayedError is a recorded error served by a replay.
+type ReplayedError struct {
+	Message string
+	kind    error
+}
+
+func (e *ReplayedError) Error() string { return e.Message }
+func (e *ReplayedError) Unwrap() error { return e.kind }
+
+// ErrNotRecorded is returned by a replay for a call missing from the cassette.
+var ErrNotRecorded = errors.New("call not recorded in cassette")
+
+// key returns the replay key of an input: its kind and normalized JSON.
+func key(kind string, input json.RawMessage) (string, error) {
+	var v any
+	if err := json.Unmarshal(input, &v); err != nil {
+		return "", fmt.Errorf("parse %s input: %w", kind, err)
+	}
+	b, err := json.Marshal(normalize(v))
+	if err != nil {
+		return "", err
+	}
+	return kind + " " + string(b), nil
+}
+
+// normalize collapses whitespace in every string. Object keys are sorted by
+// json.Marshal.
+func normalize(v any) any {
+	switch t := v.(type) {
+	case string:
+		return strings.Join(strings.Fields(t), " ")
+	case []any:
+		for i := range t {
+			t[i] = normalize(t[i])
+		}
+	case map[string]any:
+		for k := range t {
+			t[k] = normalize(t[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,161 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/llm"
+	"github.com/shunpei/rulegate/internal/logging"
+)
+
+type stubRetriever struct{ calls int }
+
+func (s *stubRetriever) RetrieveContexts(_ context.Context, query, _ string, _ int) ([]domain.RetrievedContext, error) {
+	s.calls++
+	return []domain.RetrievedContext{{Text: "ctx for " + query, Score: 0.8, RuleID: "29.4"}}, nil
+}
+func (s *stubRetriever) HealthCheck(context.Context) error { return nil }
+func (s *stubRetriever) Close() error                      { return nil }
+
+type stubLLM struct {
+	answerErr error
+}
+
+func (s *stubLLM) RewriteQuery(_ context.Context, in llm.RewriteInput) (*domain.RewriteResult, error) {
+	return &domain.RewriteResult{
+		QueryEN: "en: " + in.Question,
+		CallInfo: domain.CallInfo{
+			Model: "rewrite-model",
+			Usage: &domain.Usage{Model: "rewrite-model", PromptTokens: 10},
+		},
+	}, nil
+}
+func (s *stubLLM) GenerateAnswer(_ context.Context, in llm.AnswerInput) (*domain.AnswerResult, error) {
+	if s.answerErr != nil {
+		return nil, s.answerErr
+	}
+	return &domain.AnswerResult{
+		Answer:   "answer to " + in.Question,
+		CallInfo: domain.CallInfo{Model: "answer-model"},
+		Warnings: []string{"contexts_truncated: 1"},
+	}, nil
+}
+func (s *stubLLM) HealthCheck(context.Context) error { return nil }
+func (s *stubLLM) DecomposeQuestion(_ context.Context, in llm.DecomposeInput) (*domain.DecomposeResult, error) {
+	return &domain.DecomposeResult{SubQuestions: []string{in.Question}}, nil
+}
+func (s *stubLLM) Close() error { return nil }
+
+func record(t *testing.T, inner *stubLLM) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	l, r := rec.WrapLLM(inner), rec.WrapRetriever(&stubRetriever{})
+	if _, err := r.RetrieveContexts(ctx, "gate touch", "corpus", 8); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.RewriteQuery(ctx, llm.RewriteInput{Question: "ゲート接触は？", Language: domain.LangJA}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = l.GenerateAnswer(ctx, llm.AnswerInput{Question: "ゲート接触は？", Language: domain.LangJA})
+	if _, err := l.(llm.Decomposer).DecomposeQuestion(ctx, llm.DecomposeInput{Question: "q"}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRecordReplay_RoundTrip(t *testing.T) {
+	c, err := Load(record(t, &stubLLM{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	cs, err := c.Retriever().RetrieveContexts(ctx, "gate touch", "corpus", 8)
+	if err != nil || len(cs) != 1 || cs[0].RuleID != "29.4" {
+		t.Fatalf("retrieve: got %+v, %v", cs, err)
+	}
+	rw, err := c.LLM().RewriteQuery(ctx, llm.RewriteInput{Question: "ゲート接触は？", Language: domain.LangJA})
+	if err != nil || rw.QueryEN != "en: ゲート接触は？" || rw.Model != "rewrite-model" || rw.Usage.PromptTokens != 10 {
+		t.Fatalf("rewrite: got %+v, %v", rw, err)
+	}
+	ans, err := c.LLM().GenerateAnswer(ctx, llm.AnswerInput{Question: "ゲート接触は？", Language: domain.LangJA})
+	if err != nil || ans.Answer != "answer to ゲート接触は？" || ans.Model != "answer-model" || len(ans.Warnings) != 1 {
+		t.Fatalf("answer: got %+v, %v", ans, err)
+	}
+	dec, err := c.LLM().(llm.Decomposer).DecomposeQuestion(ctx, llm.DecomposeInput{Question: "q"})
+	if err != nil || len(dec.SubQuestions) != 1 {
+		t.Fatalf("decompose: got %+v, %v", dec, err)
+	}
+}
+
+func TestReplay_NormalizesWhitespace(t *testing.T) {
+	c, err := Load(record(t, &stubLLM{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Retriever().RetrieveContexts(context.Background(), "  gate\ttouch ", "corpus", 8); err != nil {
+		t.Errorf("expected a match after whitespace normalization, got %v", err)
+	}
+}
+
+func TestReplay_NotRecorded(t *testing.T) {
+	c, err := Load(record(t, &stubLLM{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Retriever().RetrieveContexts(context.Background(), "gate touch", "corpus", 5)
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("got %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestReplay_RecordedErrorKeepsSentinel(t *testing.T) {
+	path := record(t, &stubLLM{answerErr: fmt.Errorf("generate answer: %w", llm.ErrSafetyBlocked)})
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.LLM().GenerateAnswer(context.Background(), llm.AnswerInput{Question: "ゲート接触は？", Language: domain.LangJA})
+	if !errors.Is(err, llm.ErrSafetyBlocked) || !strings.Contains(err.Error(), "generate answer") {
+		t.Errorf("got %v, want a replayed ErrSafetyBlocked", err)
+	}
+
+	b, _ := os.ReadFile(path)
+	if !strings.Contains(string(b), `"request_id":"req-1"`) {
+		t.Errorf("expected request IDs in the cassette:\n%s", b)
+	}
+}
+
+func TestReplay_SameKeyServedInOrder(t *testing.T) {
+	c, err := Read(strings.NewReader(`
+{"kind":"retrieve","input":{"query":"q","corpus":"c","top_k":1},"output":[{"text":"first","score":0.1}]}
+{"kind":"retrieve","input":{"top_k":1,"corpus":"c","query":"q"},"output":[{"text":"second","score":0.2}]}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for range 3 {
+		cs, err := c.Retriever().RetrieveContexts(context.Background(), "q", "c", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, cs[0].Text)
+	}
+	if strings.Join(got, ",") != "first,second,second" {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/llm"
+	"github.com/shunpei/rulegate/internal/logging"
+	"github.com/shunpei/rulegate/internal/rag"
+)
+
+// Recorder appends every call made through its wrappers to a cassette file.
+// Each interaction is written as soon as the call returns, so a cassette
+// survives a crash and can be filtered by request_id afterwards.
+type Recorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewRecorder opens path for appending, creating it if needed.
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open cassette: %w", err)
+	}
+	return &Recorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Close closes the cassette file. It does not close wrapped clients.
+func (r *Recorder) Close() error {
+	return r.f.Close()
+}
+
+// WrapLLM returns an llm.LLM that records calls to inner, including the
+// optional Decomposer, Clarifier and InjectionClassifier methods.
+func (r *Recorder) WrapLLM(inner llm.LLM) llm.LLM {
+	return &recordingLLM{r: r, inner: inner}
+}
+
+// WrapRetriever returns a rag.Retriever that records calls to inner.
+func (r *Recorder) WrapRetriever(inner rag.Retriever) rag.Retriever {
+	return &recordingRetriever{r: r, inner: inner}
+}
+
+// record writes one interaction. Write failures are ignored: a
+// broken cassette must not fail the request being recorded.
+func (r *Recorder) record(ctx context.Context, kind string, input, output any, model string, usage *domain.Usage, warnings []string, callErr error) {
+	it := Interaction{
+		Kind:      kind,
+		RequestID: logging.RequestID(ctx),
+		Model:     model,
+		Usage:     usage,
+		Warnings:  warnings,
+	}
+	it.Input, _ = json.Marshal(input)
+	if callErr != nil {
+		it.Error, it.ErrorKind = callErr.Error(), errorKind(callErr)
+	} else {
+		it.Output, _ = json.Marshal(output)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.enc.Encode(it)
+}
+
+type recordingRetriever struct {
+	r     *Recorder
+	inner rag.Retriever
+}
+
+func (rr *recordingRetriever) RetrieveContexts(ctx context.Context, query, corpusID string, topK int) ([]domain.RetrievedContext, error) {
+	res, err := rr.inner.RetrieveContexts(ctx, query, corpusID, topK)
+	rr.r.record(ctx, KindRetrieve, retrieveInput{Query: query, Corpus: corpusID, TopK: topK}, res, "", nil, nil, err)
+	return res, err
+}
+
+// HealthCheck is passed through and not recorded.
+func (rr *recordingRetriever) HealthCheck(ctx context.Context) error {
+	return rr.inner.HealthCheck(ctx)
+}
+
+func (rr *recordingRetriever) Close() error {
+	return rr.inner.Close()
+}
+
+type recordingLLM struct {
+	r     *Recorder
+	inner llm.LLM
+}
+
+func (rl *recordingLLM) RewriteQuery(ctx context.Context, in llm.RewriteInput) (*domain.RewriteResult, error) {
+	res, err := rl.inner.RewriteQuery(ctx, in)
+	if err != nil {
+		rl.r.record(ctx, KindRewrite, newRewriteInput(in), nil, "", nil, nil, err)
+		return nil, err
+	}
+	rl.r.record(ctx, KindRewrite, newRewriteInput(in), res, res.Model, res.Usage, nil, nil)
+	return res, nil
+}
+
+func (rl *recordingLLM) GenerateAnswer(ctx context.Context, in llm.AnswerInput) (*domain.AnswerResult, error) {
+	res, err := rl.inner.GenerateAnswer(ctx, in)
+	if err != nil {
+		rl.r.record(ctx, KindAnswer, newAnswerInput(in), nil, "", nil, nil, err)
+		return nil, err
+	}
+	rl.r.record(ctx, KindAnswer, newAnswerInput(in), res, res.Model, res.Usage, res.Warnings, nil)
+	return res, nil
+}
+
+func (rl *recordingLLM) DecomposeQuestion(ctx context.Context, in llm.DecomposeInput) (*domain.DecomposeResult, error) {
+	d, ok := rl.inner.(llm.Decomposer)
+	if !ok {
+		return nil, errors.New("backend does not support question decomposition")
+	}
+	input := decomposeInput{Question: in.Question, Language: in.Language}
+	res, err := d.DecomposeQuestion(ctx, in)
+	if err != nil {
+		rl.r.record(ctx, KindDecompose, input, nil, "", nil, nil, err)
+		return nil, err
+	}
+	rl.r.record(ctx, KindDecompose, input, res, res.Model, res.Usage, nil, nil)
+	return res, nil
+}
+
+func (rl *recordingLLM) ClarifyQuestion(ctx context.Context, in llm.ClarifyInput) (*domain.ClarifyResult, error) {
+	c, ok := rl.inner.(llm.Clarifier)
+	if !ok {
+		return nil, errors.New("backend does not support clarification")
+	}
+	input := clarifyInput{Question: in.Question, Language: in.Language, Context: in.Context}
+	res, err := c.ClarifyQuestion(ctx, in)
+	if err != nil {
+		rl.r.record(ctx, KindClarify, input, nil, "", nil, nil, err)
+		return nil, err
+	}
+	rl.r.record(ctx, KindClarify, input, res, res.Model, res.Usage, nil, nil)
+	return res, nil
+}
+
+func (rl *recordingLLM) ClassifyInjection(ctx context.Context, text string) (*domain.InjectionVerdict, error) {
+	c, ok := rl.inner.(llm.InjectionClassifier)
+	if !ok {
+		return nil, errors.New("backend does not support injection classification")
+	}
+	res, err := c.ClassifyInjection(ctx, text)
+	if err != nil {
+		rl.r.record(ctx, KindInjection, injectionInput{Text: text}, nil, "", nil, nil, err)
+		return nil, err
+	}
+	rl.r.record(ctx, KindInjection, injectionInput{Text: text}, res, res.Model, res.Usage, nil, nil)
+	return res, nil
+}
+
+// HealthCheck is passed through and not recorded.
+func (rl *recordingLLM) HealthCheck(ctx context.Context) error {
+	return rl.inner.HealthCheck(ctx)
+}
+
+func (rl *recordingLLM) Close() error {
+	return rl.inner.Close()
+}
@@ -0,0 +1,184 @@
+package cassette
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/llm"
+	"github.com/shunpei/rulegate/internal/rag"
+)
+
+// Cassette serves recorded interactions. Interactions with the same key are
+// served in recording order; the last one repeats once they run out.
+type Cassette struct {
+	mu    sync.Mutex
+	calls map[string]*recorded
+}
+
+type recorded struct {
+	items []Interaction
+	next  int
+}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open cassette: %w", err)
+	}
+	defer f.Close()
+	c, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Read parses cassette lines from r. Blank lines are skipped.
+func Read(r io.Reader) (*Cassette, error) {
+	c := &Cassette{calls: map[string]*recorded{}}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var it Interaction
+		if err := json.Unmarshal(sc.Bytes(), &it); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		k, err := key(it.Kind, it.Input)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if c.calls[k] == nil {
+			c.calls[k] = &recorded{}
+		}
+		c.calls[k].items = append(c.calls[k].items, it)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LLM returns an llm.LLM that serves the recorded LLM calls.
+func (c *Cassette) LLM() llm.LLM {
+	return &replayLLM{c: c}
+}
+
+// Retriever returns a rag.Retriever that serves the recorded retrievals.
+func (c *Cassette) Retriever() rag.Retriever {
+	return &replayRetriever{c: c}
+}
+
+// play finds the next interaction for input and decodes its output into out.
+// A recorded error is returned as a *ReplayedError.
+func (c *Cassette) play(kind string, input, out any) (*Interaction, error) {
+	raw, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	k, err := key(kind, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	rec := c.calls[k]
+	if rec == nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, kind, raw)
+	}
+	it := rec.items[min(rec.next, len(rec.items)-1)]
+	rec.next++
+	c.mu.Unlock()
+
+	if it.Error != "" {
+		return nil, &ReplayedError{Message: it.Error, kind: errorKinds[it.ErrorKind]}
+	}
+	if err := json.Unmarshal(it.Output, out); err != nil {
+		return nil, fmt.Errorf("decode recorded %s output: %w", kind, err)
+	}
+	return &it, nil
+}
+
+type replayRetriever struct {
+	c *Cassette
+}
+
+func (rr *replayRetriever) RetrieveContexts(_ context.Context, query, corpusID string, topK int) ([]domain.RetrievedContext, error) {
+	var res []domain.RetrievedContext
+	if _, err := rr.c.play(KindRetrieve, retrieveInput{Query: query, Corpus: corpusID, TopK: topK}, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// HealthCheck always succeeds: replay needs nothing beyond the loaded file.
+func (rr *replayRetriever) HealthCheck(context.Context) error { return nil }
+func (rr *replayRetriever) Close() error                      { return nil }
+
+type replayLLM struct {
+	c *Cassette
+}
+
+func (rl *replayLLM) RewriteQuery(_ context.Context, in llm.RewriteInput) (*domain.RewriteResult, error) {
+	var res domain.RewriteResult
+	it, err := rl.c.play(KindRewrite, newRewriteInput(in), &res)
+	if err != nil {
+		return nil, err
+	}
+	res.Model, res.Usage = it.Model, it.Usage
+	return &res, nil
+}
+
+func (rl *replayLLM) GenerateAnswer(_ context.Context, in llm.AnswerInput) (*domain.AnswerResult, error) {
+	var res domain.AnswerResult
+	it, err := rl.c.play(KindAnswer, newAnswerInput(in), &res)
+	if err != nil {
+		return nil, err
+	}
+	res.Model, res.Usage, res.Warnings = it.Model, it.Usage, it.Warnings
+	return &res, nil
+}
+
+func (rl *replayLLM) DecomposeQuestion(_ context.Context, in llm.DecomposeInput) (*domain.DecomposeResult, error) {
+	var res domain.DecomposeResult
+	it, err := rl.c.play(KindDecompose, decomposeInput{Question: in.Question, Language: in.Language}, &res)
+	if err != nil {
+		return nil, err
+	}
+	res.Model, res.Usage = it.Model, it.Usage
+	return &res, nil
+}
+
+func (rl *replayLLM) ClarifyQuestion(_ context.Context, in llm.ClarifyInput) (*domain.ClarifyResult, error) {
+	var res domain.ClarifyResult
+	it, err := rl.c.play(KindClarify, clarifyInput{Question: in.Question, Language: in.Language, Context: in.Context}, &res)
+	if err != nil {
+		return nil, err
+	}
+	res.Model, res.Usage = it.Model, it.Usage
+	return &res, nil
+}
+
+func (rl *replayLLM) ClassifyInjection(_ context.Context, text string) (*domain.InjectionVerdict, error) {
+	var res domain.InjectionVerdict
+	it, err := rl.c.play(KindInjection, injectionInput{Text: text}, &res)
+	if err != nil {
+		return nil, err
+	}
+	res.Model, res.Usage = it.Model, it.Usage
+	return &res, nil
+}
+
+// HealthCheck always succeeds: replay needs nothing beyond the loaded file.
+func (rl *replayLLM) HealthCheck(context.Context) error { return nil }
+func (rl *replayLLM) Close() error                      { return nil }
@@ -0,0 +1,76 @@
+package conversation
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// MemoryStore keeps conversations in process memory. History is lost on
+// restart and not shared between instances.
+type MemoryStore struct {
+	opts Options
+	now  func() time.Time
+
+	mu        sync.Mutex
+	convs     map[string]*memoryConversation
+	lastPrune time.Time
+}
+
+type memoryConversation struct {
+	turns   []domain.Turn
+	updated time.Time
+}
+
+func NewMemoryStore(opts Options) *MemoryStore {
+	return &MemoryStore{
+		opts:  opts.withDefaults(),
+		now:   time.Now,
+		convs: map[string]*memoryConversation{},
+	}
+}
+
+func (s *MemoryStore) History(_ context.Context, id string) ([]domain.Turn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.convs[id]
+	if !ok || s.expired(c, s.now()) {
+		return nil, ErrNotFound
+	}
+	return slices.Clone(c.turns), nil
+}
+
+func (s *MemoryStore) Append(_ context.Context, id string, turn domain.Turn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	c, ok := s.convs[id]
+	if !ok || s.expired(c, now) {
+		c = &memoryConversation{}
+		s.convs[id] = c
+	}
+	c.turns = append(c.turns, turn)
+	if n := len(c.turns) - s.opts.MaxTurns; n > 0 {
+		c.turns = slices.Delete(c.turns, 0, n)
+	}
+	c.updated = now
+
+	if now.Sub(s.lastPrune) >= pruneInterval {
+		for k, c := range s.convs {
+			if s.expired(c, now) {
+				delete(s.convs, k)
+			}
+		}
+		s.lastPrune = now
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error { return nil }
+
+func (s *MemoryStore) expired(c *memoryConversation, now time.Time) bool {
+	return now.Sub(c.updated) > s.opts.TTL
+}
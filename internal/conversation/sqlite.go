@@ -0,0 +1,159 @@
+package conversation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// SQLiteDriver is the database/sql driver name SQLiteStore opens. The driver
+// itself is registered by the binary (see cmd/api), so this package builds
+// without cgo.
+const SQLiteDriver = "sqlite3"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS conversation_turns (
+	seq             INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id TEXT    NOT NULL,
+	turn_json       TEXT    NOT NULL,
+	created_at      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS conversation_turns_by_id ON conversation_turns (conversation_id, seq);
+`
+
+// SQLiteStore keeps conversations in a SQLite database file, so history
+// survives restarts of a single instance.
+type SQLiteStore struct {
+	db   *sql.DB
+	opts Options
+	now  func() time.Time
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// OpenSQLite opens (creating if needed) the database at path.
+func OpenSQLite(path string, opts Options) (*SQLiteStore, error) {
+	if !slices.Contains(sql.Drivers(), SQLiteDriver) {
+		return nil, fmt.Errorf("sqlite driver %q is not registered (build with CGO_ENABLED=1)", SQLiteDriver)
+	}
+	db, err := sql.Open(SQLiteDriver, path)
+	if err != nil {
+		return nil, fmt.Errorf("open conversation db: %w", err)
+	}
+	// A single connection serializes writers; SQLite allows only one anyway.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create conversation schema: %w", err)
+	}
+	return &SQLiteStore{db: db, opts: opts.withDefaults(), now: time.Now}, nil
+}
+
+func (s *SQLiteStore) History(ctx context.Context, id string) ([]domain.Turn, error) {
+	cutoff := s.now().Add(-s.opts.TTL).UnixMilli()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT turn_json, created_at FROM conversation_turns
+		WHERE conversation_id = ?
+		ORDER BY seq DESC LIMIT ?`, id, s.opts.MaxTurns)
+	if err != nil {
+		return nil, fmt.Errorf("query conversation: %w", err)
+	}
+	defer rows.Close()
+
+	var turns []domain.Turn
+	for rows.Next() {
+		var (
+			raw     string
+			created int64
+		)
+		if err := rows.Scan(&raw, &created); err != nil {
+			return nil, fmt.Errorf("scan conversation turn: %w", err)
+		}
+		// Rows are newest first: the first one decides expiry.
+		if len(turns) == 0 && created < cutoff {
+			return nil, ErrNotFound
+		}
+		var t domain.Turn
+		if err := json.Unmarshal([]byte(raw), &t); err != nil {
+			return nil, fmt.Errorf("decode conversation turn: %w", err)
+		}
+		turns = append(turns, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query conversation: %w", err)
+	}
+	if len(turns) == 0 {
+		return nil, ErrNotFound
+	}
+	slices.Reverse(turns)
+	return turns, nil
+}
+
+func (s *SQLiteStore) Append(ctx context.Context, id string, turn domain.Turn) error {
+	raw, err := json.Marshal(turn)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	cutoff := now.Add(-s.opts.TTL).UnixMilli()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("append conversation turn: %w", err)
+	}
+	defer tx.Rollback()
+
+	// An expired conversation restarts empty under the same ID.
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM conversation_turns WHERE conversation_id = ?
+		AND (SELECT MAX(created_at) FROM conversation_turns WHERE conversation_id = ?) < ?`,
+		id, id, cutoff); err != nil {
+		return fmt.Errorf("append conversation turn: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO conversation_turns (conversation_id, turn_json, created_at) VALUES (?, ?, ?)`,
+		id, string(raw), now.UnixMilli()); err != nil {
+		return fmt.Errorf("append conversation turn: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM conversation_turns WHERE conversation_id = ? AND seq NOT IN (
+			SELECT seq FROM conversation_turns WHERE conversation_id = ? ORDER BY seq DESC LIMIT ?)`,
+		id, id, s.opts.MaxTurns); err != nil {
+		return fmt.Errorf("trim conversation: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("append conversation turn: %w", err)
+	}
+
+	s.prune(ctx, now, cutoff)
+	return nil
+}
+
+// prune deletes expired conversations at most once per pruneInterval.
+// Failures only delay the cleanup.
+func (s *SQLiteStore) prune(ctx context.Context, now time.Time, cutoff int64) {
+	s.mu.Lock()
+	due := now.Sub(s.lastPrune) >= pruneInterval
+	if due {
+		s.lastPrune = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+	_, _ = s.db.ExecContext(ctx, `
+		DELETE FROM conversation_turns WHERE conversation_id IN (
+			SELECT conversation_id FROM conversation_turns
+			GROUP BY conversation_id HAVING MAX(created_at) < ?)`, cutoff)
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,60 @@
+// Package conversation stores the recent turns of multi-turn conversations
+// so follow-up questions can be resolved against earlier answers.
+package conversation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+const (
+	// DefaultTTL is how long a conversation survives after its last turn.
+	DefaultTTL = 30 * time.Minute
+	// DefaultMaxTurns is how many recent turns are kept per conversation.
+	DefaultMaxTurns = 5
+	// pruneInterval spaces out the sweeps that delete expired conversations.
+	pruneInterval = time.Minute
+)
+
+// ErrNotFound is returned for unknown and expired conversations.
+var ErrNotFound = errors.New("conversation not found")
+
+// Store is a conversation history store. Conversations expire TTL after
+// their last appended turn; only the most recent turns are kept.
+type Store interface {
+	// History returns the kept turns of a conversation, oldest first.
+	History(ctx context.Context, id string) ([]domain.Turn, error)
+	// Append adds a turn, creating the conversation if needed.
+	Append(ctx context.Context, id string, turn domain.Turn) error
+	Close() error
+}
+
+// Options configures a Store.
+type Options struct {
+	// TTL <= 0 means DefaultTTL.
+	TTL time.Duration
+	// MaxTurns <= 0 means DefaultMaxTurns.
+	MaxTurns int
+}
+
+func (o Options) withDefaults() Options {
+	if o.TTL <= 0 {
+		o.TTL = DefaultTTL
+	}
+	if o.MaxTurns <= 0 {
+		o.MaxTurns = DefaultMaxTurns
+	}
+	return o
+}
+
+// NewID returns a random conversation ID.
+func NewID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
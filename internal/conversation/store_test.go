@@ -0,0 +1,69 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// testStore runs the behaviour every Store must share. advance moves the
+// store's clock forward.
+func testStore(t *testing.T, s Store, advance func(time.Duration)) {
+	ctx := context.Background()
+
+	if _, err := s.History(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown conversation: got %v, want ErrNotFound", err)
+	}
+
+	for i := range 4 {
+		turn := domain.Turn{
+			Question:  fmt.Sprintf("q%d", i),
+			Answer:    fmt.Sprintf("a%d", i),
+			Citations: []domain.TurnCitation{{RuleID: "29.4"}},
+		}
+		if err := s.Append(ctx, "c1", turn); err != nil {
+			t.Fatal(err)
+		}
+		advance(time.Second)
+	}
+	turns, err := s.History(ctx, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MaxTurns is 3: the oldest turn is dropped, the rest stay in order.
+	if len(turns) != 3 || turns[0].Question != "q1" || turns[2].Question != "q3" || turns[2].Citations[0].RuleID != "29.4" {
+		t.Errorf("unexpected history: %+v", turns)
+	}
+
+	advance(time.Hour)
+	if _, err := s.History(ctx, "c1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired conversation: got %v, want ErrNotFound", err)
+	}
+	if err := s.Append(ctx, "c1", domain.Turn{Question: "again"}); err != nil {
+		t.Fatal(err)
+	}
+	turns, err = s.History(ctx, "c1")
+	if err != nil || len(turns) != 1 || turns[0].Question != "again" {
+		t.Errorf("expected an expired conversation to restart, got %+v, %v", turns, err)
+	}
+}
+
+var testOptions = Options{TTL: 30 * time.Minute, MaxTurns: 3}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore(testOptions)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	testStore(t, s, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestNewID(t *testing.T) {
+	a, b := NewID(), NewID()
+	if len(a) != 32 || a == b {
+		t.Errorf("unexpected IDs %q, %q", a, b)
+	}
+}
@@ -0,0 +1,87 @@
+package domain
+
+import "fmt"
+
+// DefaultBatchMaxQuestions bounds POST /api/ask/batch unless configured.
+const DefaultBatchMaxQuestions = 50
+
+// BatchAskRequest is the JSON body for POST /api/ask/batch. Every question
+// shares the language, discipline, edition, context and options.
+type BatchAskRequest struct {
+	Questions   []BatchQuestion `json:"questions"`
+	Language    Language        `json:"language,omitempty"`
+	Discipline  string          `json:"discipline,omitempty"`
+	RuleEdition string          `json:"rule_edition,omitempty"`
+	Context     *QueryContext   `json:"context,omitempty"`
+	Options     *RequestOption  `json:"options,omitempty"`
+}
+
+// BatchQuestion is one question of a batch. ID is an optional client label
+// echoed in the result; Context overrides the shared context.
+type BatchQuestion struct {
+	ID       string        `json:"id,omitempty"`
+	Question string        `json:"question"`
+	Context  *QueryContext `json:"context,omitempty"`
+}
+
+// Validate checks the batch size. Each question is validated on its own.
+func (r *BatchAskRequest) Validate(maxQuestions int) error {
+	if len(r.Questions) == 0 {
+		return NewValidationError("questions must not be empty")
+	}
+	if len(r.Questions) > maxQuestions {
+		return NewValidationError(fmt.Sprintf("questions must have at most %d items", maxQuestions))
+	}
+	return nil
+}
+
+// AskRequest builds the single-question request for questions[i].
+func (r *BatchAskRequest) AskRequest(i int) AskRequest {
+	q := r.Questions[i]
+	req := AskRequest{
+		Question:    q.Question,
+		Language:    r.Language,
+		Discipline:  r.Discipline,
+		RuleEdition: r.RuleEdition,
+		Context:     r.Context,
+		Options:     r.Options,
+	}
+	if q.Context != nil {
+		req.Context = q.Context
+	}
+	if req.Context != nil {
+		// Items must not share a context that Validate may modify.
+		c := *req.Context
+		req.Context = &c
+	}
+	return req
+}
+
+// BatchAskResponse holds one result per question, in request order.
+type BatchAskResponse struct {
+	Results []BatchItemResult `json:"results"`
+	Meta    BatchMeta         `json:"meta"`
+}
+
+// BatchItemResult is the outcome of one question: exactly one of Response,
+// Clarification and Error is set, and Status is the HTTP status the question
+// would have had on POST /api/ask.
+type BatchItemResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	// RequestID identifies the question's answer, e.g. for POST /api/feedback.
+	RequestID     string                 `json:"request_id"`
+	Status        int                    `json:"status"`
+	Response      *AskResponse           `json:"response,omitempty"`
+	Clarification *ClarificationResponse `json:"clarification,omitempty"`
+	Error         *ErrorResponse         `json:"error,omitempty"`
+}
+
+// BatchMeta summarizes a batch.
+type BatchMeta struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	// Usage sums the items' usage; set only when usage is exposed.
+	Usage *UsageSummary `json:"usage,omitempty"`
+}
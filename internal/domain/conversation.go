@@ -0,0 +1,34 @@
+package domain
+
+// Turn is one answered question of a conversation. The recent turns are
+// given to the rewrite prompt to resolve follow-up questions.
+type Turn struct {
+	Question string `json:"question"`
+	// StandaloneQuestion is the question with references to earlier turns
+	// resolved; empty when the question was already standalone.
+	StandaloneQuestion string         `json:"standalone_question,omitempty"`
+	Answer             string         `json:"answer"`
+	Citations          []TurnCitation `json:"citations,omitempty"`
+	Context            *QueryContext  `json:"context,omitempty"`
+}
+
+// TurnCitation is the part of a Citation kept in conversation history.
+type TurnCitation struct {
+	RuleID       string `json:"rule_id"`
+	SectionTitle string `json:"section_title,omitempty"`
+}
+
+// validConversationID reports whether id is a safe, bounded conversation ID.
+func validConversationID(id string) bool {
+	if len(id) == 0 || len(id) > MaxConversationIDLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -9,6 +9,12 @@ const (
 	ErrCatValidation ErrorCategory = "validation"
 	ErrCatRateLimit  ErrorCategory = "rate_limit"
 	ErrCatVertexErr  ErrorCategory = "vertex_error"
+	ErrCatInjection  ErrorCategory = "injection"
+	ErrCatAuth       ErrorCategory = "unauthorized"
+	ErrCatSafety     ErrorCategory = "safety_blocked"
+	ErrCatRecitation ErrorCategory = "recitation"
+	ErrCatTruncated  ErrorCategory = "output_truncated"
+	ErrCatTooLarge   ErrorCategory = "body_too_large"
 	ErrCatUnknown    ErrorCategory = "unknown"
 )
 
@@ -18,6 +24,9 @@ type AppError struct {
 	Message    string
 	StatusCode int
 	Err        error
+	// Details is returned to the client alongside Message, e.g. the field
+	// that failed validation.
+	Details string
 }
 
 func (e *AppError) Error() string {
@@ -39,6 +48,27 @@ func NewValidationError(msg string) *AppError {
 	}
 }
 
+// NewSchemaError rejects a request body that does not match the API schema;
+// details names the offending field.
+func NewSchemaError(details string) *AppError {
+	return &AppError{
+		Category:   ErrCatValidation,
+		Message:    "request body does not match the API schema",
+		StatusCode: 400,
+		Details:    details,
+	}
+}
+
+// NewBodyTooLargeError rejects a request body larger than limit bytes.
+func NewBodyTooLargeError(limit int64) *AppError {
+	return &AppError{
+		Category:   ErrCatTooLarge,
+		Message:    "request body too large",
+		StatusCode: 413,
+		Details:    fmt.Sprintf("the limit is %d bytes", limit),
+	}
+}
+
 func NewRateLimitError() *AppError {
 	return &AppError{
 		Category:   ErrCatRateLimit,
@@ -47,6 +77,25 @@ func NewRateLimitError() *AppError {
 	}
 }
 
+// NewInjectionError rejects a question that looks like a prompt injection.
+// The message is shown to end users as-is.
+func NewInjectionError(rules []string) *AppError {
+	return &AppError{
+		Category:   ErrCatInjection,
+		Message:    "質問にシステムへの指示と解釈される表現が含まれているため、回答できません。質問内容を見直してください。",
+		StatusCode: 400,
+		Err:        fmt.Errorf("matched rules: %v", rules),
+	}
+}
+
+func NewUnauthorizedError() *AppError {
+	return &AppError{
+		Category:   ErrCatAuth,
+		Message:    "unauthorized",
+		StatusCode: 401,
+	}
+}
+
 func NewVertexError(msg string, err error) *AppError {
 	return &AppError{
 		Category:   ErrCatVertexErr,
@@ -56,6 +105,39 @@ func NewVertexError(msg string, err error) *AppError {
 	}
 }
 
+// NewSafetyBlockedError reports a question or answer blocked by the model's
+// safety filters. The message is shown to end users as-is.
+func NewSafetyBlockedError(err error) *AppError {
+	return &AppError{
+		Category:   ErrCatSafety,
+		Message:    "質問または回答が安全性フィルタによりブロックされたため、回答できません。表現を変えて質問してください。",
+		StatusCode: 422,
+		Err:        err,
+	}
+}
+
+// NewRecitationError reports an answer stopped for reproducing source text
+// verbatim. The message is shown to end users as-is.
+func NewRecitationError(err error) *AppError {
+	return &AppError{
+		Category:   ErrCatRecitation,
+		Message:    "回答が出典の文章をそのまま引用する内容になったため、生成を中止しました。質問を言い換えてお試しください。",
+		StatusCode: 422,
+		Err:        err,
+	}
+}
+
+// NewTruncatedError reports an answer that exceeded the output token limit
+// even after retrying. The message is shown to end users as-is.
+func NewTruncatedError(err error) *AppError {
+	return &AppError{
+		Category:   ErrCatTruncated,
+		Message:    "回答が長くなりすぎたため生成を完了できませんでした。質問の範囲を絞ってお試しください。",
+		StatusCode: 502,
+		Err:        err,
+	}
+}
+
 func NewInternalError(msg string, err error) *AppError {
 	return &AppError{
 		Category:   ErrCatUnknown,
@@ -0,0 +1,74 @@
+package domain
+
+import "fmt"
+
+// FeedbackRating is an official's verdict on an answer.
+type FeedbackRating string
+
+const (
+	RatingHelpful    FeedbackRating = "helpful"
+	RatingWrong      FeedbackRating = "wrong"
+	RatingIncomplete FeedbackRating = "incomplete"
+)
+
+const (
+	MaxFeedbackCommentLen = 2000
+	// MaxRequestIDLen bounds the request IDs feedback refers to.
+	MaxRequestIDLen = 64
+	maxRuleIDLen    = 32
+	maxPromptIDLen  = 64
+)
+
+// FeedbackRequest is the JSON body for POST /api/feedback. RequestID is the
+// X-Request-ID header of the answer being rated (for a batch item,
+// "<batch request ID>.<n>").
+type FeedbackRequest struct {
+	RequestID string         `json:"request_id"`
+	Rating    FeedbackRating `json:"rating"`
+	Comment   string         `json:"comment,omitempty"`
+	// CorrectRuleID is the rule the answer should have cited, if known.
+	CorrectRuleID string `json:"correct_rule_id,omitempty"`
+	// PromptVersion and PromptVariant are copied from the rated answer's
+	// meta, so ratings are recorded against the prompts that produced it.
+	// Without them the server assumes the current prompts.
+	PromptVersion string `json:"prompt_version,omitempty"`
+	PromptVariant string `json:"prompt_variant,omitempty"`
+}
+
+// FeedbackResponse acknowledges stored feedback.
+type FeedbackResponse struct {
+	Status string `json:"status"`
+}
+
+// Validate checks the rating and field lengths.
+func (r *FeedbackRequest) Validate() error {
+	if r.RequestID == "" || len(r.RequestID) > MaxRequestIDLen || !validRequestID(r.RequestID) {
+		return NewValidationError(fmt.Sprintf("request_id must be 1-%d characters of A-Z, a-z, 0-9, '-', '_' or '.'", MaxRequestIDLen))
+	}
+	switch r.Rating {
+	case RatingHelpful, RatingWrong, RatingIncomplete:
+	default:
+		return NewValidationError(fmt.Sprintf("rating must be helpful, wrong or incomplete, got %q", r.Rating))
+	}
+	if len([]rune(r.Comment)) > MaxFeedbackCommentLen {
+		return NewValidationError(fmt.Sprintf("comment must be <= %d characters", MaxFeedbackCommentLen))
+	}
+	if len(r.CorrectRuleID) > maxRuleIDLen {
+		return NewValidationError(fmt.Sprintf("correct_rule_id must be <= %d characters", maxRuleIDLen))
+	}
+	if len(r.PromptVersion) > maxPromptIDLen || len(r.PromptVariant) > maxPromptIDLen {
+		return NewValidationError(fmt.Sprintf("prompt_version and prompt_variant must be <= %d characters", maxPromptIDLen))
+	}
+	return nil
+}
+
+func validRequestID(id string) bool {
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package domain
+
+// HealthStatus is the state of the service or of one of its dependencies.
+type HealthStatus string
+
+const (
+	HealthOK HealthStatus = "ok"
+	// HealthDegraded means requests are served, but something needs
+	// attention (e.g. a prompt reload failed and older prompts are in use).
+	HealthDegraded HealthStatus = "degraded"
+	// HealthUnavailable means requests would fail.
+	HealthUnavailable HealthStatus = "unavailable"
+)
+
+// ReadinessResponse is the /readyz body. Status is the worst status of the
+// checks.
+type ReadinessResponse struct {
+	Status HealthStatus                `json:"status"`
+	Checks map[string]DependencyStatus `json:"checks"`
+}
+
+// DependencyStatus is the result of one readiness check.
+type DependencyStatus struct {
+	Status    HealthStatus `json:"status"`
+	Error     string       `json:"error,omitempty"`
+	LatencyMS int64        `json:"latency_ms"`
+	// Version is the prompt version in use (prompts check only).
+	Version string `json:"version,omitempty"`
+}
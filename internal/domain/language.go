@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Language is a supported question/answer language (ISO 639-1 code).
+type Language string
+
+const (
+	LangJA Language = "ja"
+	LangEN Language = "en"
+	LangKO Language = "ko"
+
+	DefaultLanguage = LangJA
+)
+
+var languageNames = map[Language]string{
+	LangJA: "Japanese",
+	LangEN: "English",
+	LangKO: "Korean",
+}
+
+var notFoundMessages = map[Language]string{
+	LangJA: "ルール本文に該当箇所が見当たりません",
+	LangEN: "No matching passage was found in the rules.",
+	LangKO: "규칙 본문에서 해당하는 내용을 찾을 수 없습니다.",
+}
+
+// ParseLanguage normalizes a language code such as "EN" or "ko-KR".
+func ParseLanguage(s string) (Language, error) {
+	code, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "-")
+	l := Language(code)
+	if _, ok := languageNames[l]; !ok {
+		return "", fmt.Errorf("unsupported language %q (supported: ja, en, ko)", s)
+	}
+	return l, nil
+}
+
+// Name returns the English name of the language, used in prompts.
+func (l Language) Name() string {
+	if n, ok := languageNames[l]; ok {
+		return n
+	}
+	return languageNames[DefaultLanguage]
+}
+
+// NotFoundMessage returns the localized "not found in rules" answer.
+func (l Language) NotFoundMessage() string {
+	if m, ok := notFoundMessages[l]; ok {
+		return m
+	}
+	return notFoundMessages[DefaultLanguage]
+}
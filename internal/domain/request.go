@@ -3,41 +3,167 @@ package domain
 import "fmt"
 
 // AskRequest is the JSON body for POST /ask.
+// Either Question (with Language) or the legacy QuestionJA must be set.
 type AskRequest struct {
-	QuestionJA  string         `json:"question_ja"`
-	Discipline  string         `json:"discipline"`
-	RuleEdition string         `json:"rule_edition"`
+	Question    string         `json:"question,omitempty"`
+	Language    Language       `json:"language,omitempty"`
+	QuestionJA  string         `json:"question_ja,omitempty"`
+	Discipline  string         `json:"discipline,omitempty"`
+	RuleEdition string         `json:"rule_edition,omitempty"`
 	Context     *QueryContext  `json:"context,omitempty"`
 	Options     *RequestOption `json:"options,omitempty"`
+	// Clarification is set on the follow-up to a ClarificationResponse.
+	Clarification *ClarificationReply `json:"clarification,omitempty"`
+	// ConversationID continues a conversation returned by an earlier response.
+	ConversationID string `json:"conversation_id,omitempty"`
 }
 
 type QueryContext struct {
 	BoatClass string `json:"boat_class,omitempty"`
 	RacePhase string `json:"race_phase,omitempty"`
+	EventType string `json:"event_type,omitempty"`
 	Notes     string `json:"notes,omitempty"`
 }
 
+// ClarifiableFields lists the QueryContext fields a clarification may ask for.
+var ClarifiableFields = []string{"boat_class", "race_phase", "event_type"}
+
+// Set sets the field named by its JSON name. Only ClarifiableFields are accepted.
+func (q *QueryContext) Set(field, value string) error {
+	switch field {
+	case "boat_class":
+		q.BoatClass = value
+	case "race_phase":
+		q.RacePhase = value
+	case "event_type":
+		q.EventType = value
+	default:
+		return fmt.Errorf("unknown context field %q", field)
+	}
+	return nil
+}
+
+// Merge copies the non-empty fields of o into q.
+func (q *QueryContext) Merge(o QueryContext) {
+	if o.BoatClass != "" {
+		q.BoatClass = o.BoatClass
+	}
+	if o.RacePhase != "" {
+		q.RacePhase = o.RacePhase
+	}
+	if o.EventType != "" {
+		q.EventType = o.EventType
+	}
+	if o.Notes != "" {
+		q.Notes = o.Notes
+	}
+}
+
+// ClarificationReply answers a ClarificationResponse. The follow-up request
+// repeats the original question and carries the chosen options' contexts.
+type ClarificationReply struct {
+	Choices []QueryContext `json:"choices"`
+}
+
 type RequestOption struct {
-	TopK           *int    `json:"top_k,omitempty"`
-	MinConfidence  *float64 `json:"min_confidence,omitempty"`
-	ReturnContexts bool    `json:"return_contexts,omitempty"`
-	AnswerStyle    string  `json:"answer_style,omitempty"`
+	TopK           *int          `json:"top_k,omitempty"`
+	MinConfidence  *float64      `json:"min_confidence,omitempty"`
+	ReturnContexts bool          `json:"return_contexts,omitempty"`
+	AnswerStyle    string        `json:"answer_style,omitempty"`
+	RetrievalMode  RetrievalMode `json:"retrieval_mode,omitempty"`
+	Decompose      *bool         `json:"decompose,omitempty"`
+	// AllowClarification lets the pipeline answer with a ClarificationResponse.
+	AllowClarification bool `json:"allow_clarification,omitempty"`
+	// Debug returns a pipeline trace; it requires the admin token.
+	Debug bool `json:"debug,omitempty"`
+}
+
+// RetrievalMode selects the retrieval query built from the rewrite.
+type RetrievalMode string
+
+const (
+	// RetrievalQuery retrieves with the rewritten English query (q_en).
+	RetrievalQuery RetrievalMode = "query"
+	// RetrievalHyDE retrieves with a hypothetical rule passage only.
+	RetrievalHyDE RetrievalMode = "hyde"
+	// RetrievalHyDEFused retrieves with both and merges the results.
+	RetrievalHyDEFused RetrievalMode = "hyde_fused"
+)
+
+// ParseRetrievalMode validates a retrieval mode name.
+func ParseRetrievalMode(s string) (RetrievalMode, error) {
+	switch m := RetrievalMode(s); m {
+	case RetrievalQuery, RetrievalHyDE, RetrievalHyDEFused:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown retrieval mode %q (want query, hyde or hyde_fused)", s)
+}
+
+// UsesHyDE reports whether the mode needs a hypothetical passage.
+func (m RetrievalMode) UsesHyDE() bool {
+	return m == RetrievalHyDE || m == RetrievalHyDEFused
 }
 
 const (
 	DefaultDiscipline  = "canoe_slalom"
 	DefaultRuleEdition = "2025"
 	MaxQuestionLen     = 1000
+	// MaxConversationIDLen bounds client-supplied conversation IDs.
+	MaxConversationIDLen = 64
 )
 
-// Validate checks required fields and applies defaults.
+// Validate checks required fields and applies defaults. After a successful
+// call, Question holds the question text and Language its normalized code;
+// a legacy question_ja request is treated as Japanese.
 func (r *AskRequest) Validate() error {
-	if r.QuestionJA == "" {
-		return NewValidationError("question_ja is required")
+	field := "question"
+	switch {
+	case r.Question != "" && r.QuestionJA != "":
+		return NewValidationError("question and question_ja are mutually exclusive")
+	case r.Question == "" && r.QuestionJA != "":
+		field = "question_ja"
+		if r.Language != "" && r.Language != LangJA {
+			return NewValidationError("question_ja cannot be combined with language; use question")
+		}
+		r.Question, r.Language = r.QuestionJA, LangJA
+	case r.Question == "":
+		return NewValidationError("question is required")
+	}
+	if len([]rune(r.Question)) > MaxQuestionLen {
+		return NewValidationError(fmt.Sprintf("%s must be <= %d characters", field, MaxQuestionLen))
 	}
-	if len([]rune(r.QuestionJA)) > MaxQuestionLen {
-		return NewValidationError(fmt.Sprintf("question_ja must be <= %d characters", MaxQuestionLen))
+
+	if r.Language == "" {
+		r.Language = DefaultLanguage
 	}
+	lang, err := ParseLanguage(string(r.Language))
+	if err != nil {
+		return NewValidationError(err.Error())
+	}
+	r.Language = lang
+
+	if r.Options != nil && r.Options.RetrievalMode != "" {
+		if _, err := ParseRetrievalMode(string(r.Options.RetrievalMode)); err != nil {
+			return NewValidationError(err.Error())
+		}
+	}
+
+	if r.ConversationID != "" && !validConversationID(r.ConversationID) {
+		return NewValidationError(fmt.Sprintf("conversation_id must be 1-%d characters of A-Z, a-z, 0-9, '-' or '_'", MaxConversationIDLen))
+	}
+
+	if r.Clarification != nil {
+		if len(r.Clarification.Choices) == 0 {
+			return NewValidationError("clarification.choices must not be empty")
+		}
+		if r.Context == nil {
+			r.Context = &QueryContext{}
+		}
+		for _, choice := range r.Clarification.Choices {
+			r.Context.Merge(choice)
+		}
+	}
+
 	if r.Discipline == "" {
 		r.Discipline = DefaultDiscipline
 	}
@@ -68,3 +194,36 @@ func (r *AskRequest) EffectiveMinConfidence(defaultMinConf float64) float64 {
 	}
 	return defaultMinConf
 }
+
+// EffectiveRetrievalMode returns the retrieval_mode option, falling back to the provided default.
+func (r *AskRequest) EffectiveRetrievalMode(defaultMode RetrievalMode) RetrievalMode {
+	if r.Options != nil && r.Options.RetrievalMode != "" {
+		return r.Options.RetrievalMode
+	}
+	return defaultMode
+}
+
+// EffectiveDecompose returns the decompose option, falling back to the provided default.
+func (r *AskRequest) EffectiveDecompose(defaultDecompose bool) bool {
+	if r.Options != nil && r.Options.Decompose != nil {
+		return *r.Options.Decompose
+	}
+	return defaultDecompose
+}
+
+// ContextsRequested reports whether the response should list the retrieved
+// contexts.
+func (r *AskRequest) ContextsRequested() bool {
+	return r.Options != nil && r.Options.ReturnContexts
+}
+
+// DebugRequested reports whether the response should carry a pipeline trace.
+func (r *AskRequest) DebugRequested() bool {
+	return r.Options != nil && r.Options.Debug
+}
+
+// ClarificationAllowed reports whether the pipeline may ask a clarifying
+// question. A follow-up to a clarification is always answered.
+func (r *AskRequest) ClarificationAllowed() bool {
+	return r.Options != nil && r.Options.AllowClarification && r.Clarification == nil
+}
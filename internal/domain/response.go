@@ -1,11 +1,37 @@
 package domain
 
 // AskResponse is the JSON response for POST /ask.
+// AnswerJA duplicates Answer for Japanese responses so existing clients keep working.
 type AskResponse struct {
-	AnswerJA   string     `json:"answer_ja"`
+	Answer     string     `json:"answer"`
+	Language   Language   `json:"language"`
+	AnswerJA   string     `json:"answer_ja,omitempty"`
 	Confidence float64    `json:"confidence"`
 	Citations  []Citation `json:"citations"`
-	Meta       Meta       `json:"meta"`
+	// ConversationID is set when conversations are enabled; send it back
+	// with a follow-up question.
+	ConversationID string `json:"conversation_id,omitempty"`
+	// Contexts lists the retrieved contexts when options.return_contexts is set.
+	Contexts []ContextExcerpt `json:"contexts,omitempty"`
+	Meta     Meta             `json:"meta"`
+	// Debug is the pipeline trace of an authenticated options.debug request.
+	Debug *Trace `json:"debug,omitempty"`
+}
+
+// ContextExcerpt is a retrieved context as returned to the client. Excerpt
+// is clipped like citation quotes, so the rule text is never returned in full.
+type ContextExcerpt struct {
+	RuleID       string  `json:"rule_id,omitempty"`
+	SectionTitle string  `json:"section_title,omitempty"`
+	SourceURI    string  `json:"source_uri,omitempty"`
+	Score        float64 `json:"score"`
+	Excerpt      string  `json:"excerpt"`
+	// PassedGate reports whether the context's (sub-)question passed the
+	// confidence gate, i.e. whether the context was given to the answer model.
+	PassedGate bool `json:"passed_gate"`
+	// SubQuestion is the 1-based index into Meta.SubQuestions of the part
+	// the context was retrieved for; 0 when the question was not decomposed.
+	SubQuestion int `json:"sub_question,omitempty"`
 }
 
 type Citation struct {
@@ -14,26 +40,124 @@ type Citation struct {
 	QuoteEN      string  `json:"quote_en"`
 	SourceURL    string  `json:"source_url"`
 	Score        float64 `json:"score"`
+	// SubQuestion is the 1-based index into Meta.SubQuestions of the part
+	// this citation supports; 0 when the question was not decomposed.
+	SubQuestion int `json:"sub_question,omitempty"`
 }
 
 type Meta struct {
-	RAGCorpus string   `json:"rag_corpus"`
-	TopK      int      `json:"top_k"`
-	Warnings  []string `json:"warnings"`
-}
-
-// NotFoundResponse returns the standard "not found in rules" response.
-func NotFoundResponse(corpus string, topK int) *AskResponse {
-	return &AskResponse{
-		AnswerJA:   "ルール本文に該当箇所が見当たりません",
-		Confidence: 0.0,
-		Citations:  []Citation{},
-		Meta: Meta{
-			RAGCorpus: corpus,
-			TopK:      topK,
-			Warnings:  []string{},
-		},
+	RAGCorpus    string   `json:"rag_corpus"`
+	TopK         int      `json:"top_k"`
+	Warnings     []string `json:"warnings"`
+	RewriteModel string   `json:"rewrite_model,omitempty"`
+	AnswerModel  string   `json:"answer_model,omitempty"`
+	// SubQuestions lists the parts of a decomposed question, in order.
+	SubQuestions []string `json:"sub_questions,omitempty"`
+	// PromptVersion and PromptVariant identify the prompts that produced the
+	// answer; feedback on it sends them back.
+	PromptVersion string `json:"prompt_version,omitempty"`
+	PromptVariant string `json:"prompt_variant,omitempty"`
+
+	// Usage is only populated when usage exposure is enabled.
+	Usage *UsageSummary `json:"usage,omitempty"`
+}
+
+// Usage holds token counts reported by the model for a single LLM call.
+// CachedTokens is a subset of PromptTokens.
+type Usage struct {
+	Model           string `json:"model"`
+	PromptTokens    int    `json:"prompt_tokens"`
+	CandidateTokens int    `json:"candidate_tokens"`
+	CachedTokens    int    `json:"cached_tokens"`
+	ThoughtsTokens  int    `json:"thoughts_tokens"`
+}
+
+// PromptSize is the size of a rendered prompt in characters, reported in
+// debug traces.
+type PromptSize struct {
+	SystemChars int `json:"system_chars"`
+	UserChars   int `json:"user_chars"`
+}
+
+// UsageSummary is the per-request total over all LLM calls.
+type UsageSummary struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CandidateTokens  int     `json:"candidate_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	ThoughtsTokens   int     `json:"thoughts_tokens"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+// Add accumulates u into the summary. A nil usage is ignored.
+func (s *UsageSummary) Add(u *Usage) {
+	if u == nil {
+		return
+	}
+	s.PromptTokens += u.PromptTokens
+	s.CandidateTokens += u.CandidateTokens
+	s.CachedTokens += u.CachedTokens
+	s.ThoughtsTokens += u.ThoughtsTokens
+}
+
+// Merge accumulates another summary, including its cost. A nil summary is
+// ignored.
+func (s *UsageSummary) Merge(o *UsageSummary) {
+	if o == nil {
+		return
+	}
+	s.PromptTokens += o.PromptTokens
+	s.CandidateTokens += o.CandidateTokens
+	s.CachedTokens += o.CachedTokens
+	s.ThoughtsTokens += o.ThoughtsTokens
+	s.EstimatedCostUSD += o.EstimatedCostUSD
+}
+
+// NewAskResponse returns a response with the answer text set for lang.
+func NewAskResponse(lang Language, answer string) *AskResponse {
+	resp := &AskResponse{Answer: answer, Language: lang}
+	if lang == LangJA {
+		resp.AnswerJA = answer
+	}
+	return resp
+}
+
+// ClarificationResponse is returned instead of an AskResponse when the
+// question depends on context the user has not given. Clients detect it by
+// the presence of "clarification".
+type ClarificationResponse struct {
+	Clarification Clarification `json:"clarification"`
+	// Question and Language echo the original request for the follow-up.
+	Question       string   `json:"question"`
+	Language       Language `json:"language"`
+	ConversationID string   `json:"conversation_id,omitempty"`
+	Meta           Meta     `json:"meta"`
+	Debug          *Trace   `json:"debug,omitempty"`
+}
+
+// Clarification is a clarifying question with selectable options.
+type Clarification struct {
+	Question string                `json:"question"`
+	Field    string                `json:"field"`
+	Options  []ClarificationOption `json:"options"`
+}
+
+// ClarificationOption is one choice; Context is what the follow-up request
+// sends back in clarification.choices.
+type ClarificationOption struct {
+	Label   string       `json:"label"`
+	Context QueryContext `json:"context"`
+}
+
+// NotFoundResponse returns the standard "not found in rules" response in lang.
+func NotFoundResponse(lang Language, corpus string, topK int) *AskResponse {
+	resp := NewAskResponse(lang, lang.NotFoundMessage())
+	resp.Citations = []Citation{}
+	resp.Meta = Meta{
+		RAGCorpus: corpus,
+		TopK:      topK,
+		Warnings:  []string{},
 	}
+	return resp
 }
 
 // ErrorResponse is used for non-200 error responses.
@@ -45,23 +169,106 @@ type ErrorResponse struct {
 
 // RetrievedContext represents a single context from RAG retrieval.
 type RetrievedContext struct {
-	Text         string  `json:"text"`
+	Text string `json:"text"`
+	// Score is the retriever's score until the pipeline calibrates it to a
+	// relevance in [0, 1] and keeps the original in RawScore.
 	Score        float64 `json:"score"`
+	RawScore     float64 `json:"-"`
 	SourceURI    string  `json:"source_uri,omitempty"`
 	RuleID       string  `json:"rule_id,omitempty"`
 	SectionTitle string  `json:"section_title,omitempty"`
 }
 
+// CallInfo describes the LLM call that produced a result. The LLM backend
+// sets it; it is never serialized.
+type CallInfo struct {
+	// Model is the model that produced the result.
+	Model string `json:"-"`
+	// Usage is the token usage of the call, if the backend reports it.
+	Usage *Usage `json:"-"`
+	// Prompt is the size of the rendered prompt.
+	Prompt *PromptSize `json:"-"`
+}
+
 // RewriteResult is the output of query rewriting.
 type RewriteResult struct {
 	QueryEN    string   `json:"q_en"`
 	KeywordsEN []string `json:"keywords_en"`
 	QueryJA    string   `json:"q_ja"`
+	// HypotheticalEN is a short hypothetical rule passage answering the
+	// question, only requested in HyDE retrieval modes.
+	HypotheticalEN string `json:"hypothetical_passage_en,omitempty"`
+	// StandaloneQuestion is a follow-up question rewritten to stand on its
+	// own, in the question's language; only produced when history is given.
+	StandaloneQuestion string `json:"standalone_question,omitempty"`
+
+	CallInfo
 }
 
 // AnswerResult is the output of answer generation.
+// Answer is in the requested language.
 type AnswerResult struct {
-	AnswerJA   string     `json:"answer_ja"`
+	Answer     string     `json:"answer"`
 	Citations  []Citation `json:"citations"`
 	Confidence float64    `json:"confidence"`
+
+	CallInfo
+	// Warnings are surfaced in Meta.Warnings (e.g. contexts dropped to fit the prompt).
+	Warnings []string `json:"-"`
+}
+
+// DecomposeResult is the output of question decomposition. A single-part
+// question yields one sub-question (or none).
+type DecomposeResult struct {
+	SubQuestions []string `json:"sub_questions"`
+
+	CallInfo
+}
+
+// ClarifyResult is the output of the ambiguity check.
+type ClarifyResult struct {
+	NeedsClarification bool            `json:"needs_clarification"`
+	Question           string          `json:"question"`
+	Field              string          `json:"field"`
+	Options            []ClarifyOption `json:"options"`
+
+	CallInfo
+}
+
+// ClarifyOption is a model-proposed value for ClarifyResult.Field.
+type ClarifyOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// Clarification converts the result into the client-facing form, mapping each
+// option onto Field. It returns nil when no clarification is needed or the
+// result is unusable (unknown field, fewer than two options).
+func (r *ClarifyResult) Clarification() *Clarification {
+	if !r.NeedsClarification || r.Question == "" || len(r.Options) < 2 {
+		return nil
+	}
+	cl := &Clarification{Question: r.Question, Field: r.Field}
+	for _, o := range r.Options {
+		if o.Label == "" || o.Value == "" {
+			continue
+		}
+		var qc QueryContext
+		if err := qc.Set(r.Field, o.Value); err != nil {
+			return nil
+		}
+		cl.Options = append(cl.Options, ClarificationOption{Label: o.Label, Context: qc})
+	}
+	if len(cl.Options) < 2 {
+		return nil
+	}
+	return cl
+}
+
+// InjectionVerdict is the output of the prompt injection classifier.
+type InjectionVerdict struct {
+	Injection bool   `json:"injection"`
+	Reason    string `json:"reason"`
+
+	CallInfo
 }
@@ -0,0 +1,102 @@
+package domain
+
+// Trace is the pipeline trace returned for authenticated debug requests
+// (options.debug). It is meant for investigating a single answer and may
+// change without notice.
+type Trace struct {
+	RequestID     string        `json:"request_id"`
+	PromptVersion string        `json:"prompt_version,omitempty"`
+	PromptVariant string        `json:"prompt_variant,omitempty"`
+	RetrievalMode RetrievalMode `json:"retrieval_mode"`
+	TopK          int           `json:"top_k"`
+	HistoryTurns  int           `json:"history_turns,omitempty"`
+	// Stages are the model calls outside the per-question parts
+	// (clarify, decompose, answer), in call order.
+	Stages []StageTrace `json:"stages"`
+	Parts  []PartTrace  `json:"parts"`
+	Gate   *GateTrace   `json:"gate,omitempty"`
+	// Usage is the request total, reported even when usage is not exposed.
+	Usage      UsageSummary `json:"usage"`
+	RetrieveMS int64        `json:"retrieve_ms"`
+	TotalMS    int64        `json:"total_ms"`
+}
+
+// StageTrace is one model call.
+type StageTrace struct {
+	Stage      string      `json:"stage"`
+	Model      string      `json:"model,omitempty"`
+	Usage      *Usage      `json:"usage,omitempty"`
+	Prompt     *PromptSize `json:"prompt,omitempty"`
+	DurationMS int64       `json:"duration_ms"`
+	// Error is set when the call failed and the pipeline carried on without it.
+	Error string `json:"error,omitempty"`
+}
+
+// PartTrace is the rewrite and retrieval of one (sub-)question.
+type PartTrace struct {
+	Question string       `json:"question"`
+	Rewrite  RewriteTrace `json:"rewrite"`
+	// Retrievals hold each retrieval query with its raw results.
+	Retrievals []RetrievalTrace `json:"retrievals"`
+	RetrieveMS int64            `json:"retrieve_ms"`
+	// Contexts are the merged results the gate and the answer model see.
+	Contexts []ScoredContext `json:"contexts"`
+	// MaxScore is the highest calibrated score.
+	MaxScore   float64 `json:"max_score"`
+	PassedGate bool    `json:"passed_gate"`
+}
+
+// RewriteTrace is the rewrite output of one part.
+type RewriteTrace struct {
+	QueryEN            string      `json:"q_en"`
+	KeywordsEN         []string    `json:"keywords_en,omitempty"`
+	QueryJA            string      `json:"q_ja,omitempty"`
+	HypotheticalEN     string      `json:"hypothetical_passage_en,omitempty"`
+	StandaloneQuestion string      `json:"standalone_question,omitempty"`
+	Model              string      `json:"model,omitempty"`
+	Usage              *Usage      `json:"usage,omitempty"`
+	Prompt             *PromptSize `json:"prompt,omitempty"`
+	DurationMS         int64       `json:"duration_ms"`
+}
+
+// RetrievalTrace is one retrieval query and its results as returned by the
+// retriever.
+type RetrievalTrace struct {
+	Query   string          `json:"query"`
+	Results []ScoredContext `json:"results"`
+}
+
+// ScoredContext identifies a retrieved context without its text.
+type ScoredContext struct {
+	RuleID       string `json:"rule_id,omitempty"`
+	SectionTitle string `json:"section_title,omitempty"`
+	SourceURI    string `json:"source_uri,omitempty"`
+	// RawScore is what the retriever returned; Score is its calibration,
+	// which the gate compares with the threshold.
+	RawScore float64 `json:"raw_score"`
+	Score    float64 `json:"score"`
+}
+
+// GateTrace is the confidence gate decision.
+type GateTrace struct {
+	Threshold float64 `json:"threshold"`
+	MaxScore  float64 `json:"max_score"`
+	Passed    bool    `json:"passed"`
+}
+
+// NewScoredContexts strips the text from retrieved contexts.
+func NewScoredContexts(cs []RetrievedContext) []ScoredContext {
+	out := make([]ScoredContext, len(cs))
+	for i, c := range cs {
+		out[i] = ScoredContext{RuleID: c.RuleID, SectionTitle: c.SectionTitle, SourceURI: c.SourceURI, RawScore: c.RawScore, Score: c.Score}
+	}
+	return out
+}
+
+// AddStage records a model call; it is a no-op on a nil trace, so callers
+// need not check whether debugging is on.
+func (t *Trace) AddStage(s StageTrace) {
+	if t != nil {
+		t.Stages = append(t.Stages, s)
+	}
+}
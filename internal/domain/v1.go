@@ -0,0 +1,413 @@
+package domain
+
+// The V1 types freeze the /api/v1 response contract. Do not add, remove or
+// rename fields here: new fields go on the unversioned types, which /api/v2
+// serves, and the V1 conversions below drop them. The contract covers every
+// nested type, so v1 has its own copies of them too.
+
+// AskResponseV1 is the /api/v1 form of AskResponse.
+type AskResponseV1 struct {
+	Answer         string             `json:"answer"`
+	Language       Language           `json:"language"`
+	AnswerJA       string             `json:"answer_ja,omitempty"`
+	Confidence     float64            `json:"confidence"`
+	Citations      []CitationV1       `json:"citations"`
+	ConversationID string             `json:"conversation_id,omitempty"`
+	Contexts       []ContextExcerptV1 `json:"contexts,omitempty"`
+	Meta           MetaV1             `json:"meta"`
+	Debug          *TraceV1           `json:"debug,omitempty"`
+}
+
+// CitationV1 is the /api/v1 form of Citation.
+type CitationV1 struct {
+	RuleID       string  `json:"rule_id"`
+	SectionTitle string  `json:"section_title"`
+	QuoteEN      string  `json:"quote_en"`
+	SourceURL    string  `json:"source_url"`
+	Score        float64 `json:"score"`
+	SubQuestion  int     `json:"sub_question,omitempty"`
+}
+
+// ContextExcerptV1 is the /api/v1 form of ContextExcerpt.
+type ContextExcerptV1 struct {
+	RuleID       string  `json:"rule_id,omitempty"`
+	SectionTitle string  `json:"section_title,omitempty"`
+	SourceURI    string  `json:"source_uri,omitempty"`
+	Score        float64 `json:"score"`
+	Excerpt      string  `json:"excerpt"`
+	PassedGate   bool    `json:"passed_gate"`
+	SubQuestion  int     `json:"sub_question,omitempty"`
+}
+
+// MetaV1 is the /api/v1 form of Meta.
+type MetaV1 struct {
+	RAGCorpus    string          `json:"rag_corpus"`
+	TopK         int             `json:"top_k"`
+	Warnings     []string        `json:"warnings"`
+	RewriteModel string          `json:"rewrite_model,omitempty"`
+	AnswerModel  string          `json:"answer_model,omitempty"`
+	SubQuestions []string        `json:"sub_questions,omitempty"`
+	Usage        *UsageSummaryV1 `json:"usage,omitempty"`
+}
+
+// UsageSummaryV1 is the /api/v1 form of UsageSummary.
+type UsageSummaryV1 struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CandidateTokens  int     `json:"candidate_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	ThoughtsTokens   int     `json:"thoughts_tokens"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+// UsageV1 is the /api/v1 form of Usage.
+type UsageV1 struct {
+	Model           string `json:"model"`
+	PromptTokens    int    `json:"prompt_tokens"`
+	CandidateTokens int    `json:"candidate_tokens"`
+	CachedTokens    int    `json:"cached_tokens"`
+	ThoughtsTokens  int    `json:"thoughts_tokens"`
+}
+
+// PromptSizeV1 is the /api/v1 form of PromptSize.
+type PromptSizeV1 struct {
+	SystemChars int `json:"system_chars"`
+	UserChars   int `json:"user_chars"`
+}
+
+// ClarificationResponseV1 is the /api/v1 form of ClarificationResponse.
+type ClarificationResponseV1 struct {
+	Clarification  ClarificationV1 `json:"clarification"`
+	Question       string          `json:"question"`
+	Language       Language        `json:"language"`
+	ConversationID string          `json:"conversation_id,omitempty"`
+	Meta           MetaV1          `json:"meta"`
+	Debug          *TraceV1        `json:"debug,omitempty"`
+}
+
+// ClarificationV1 is the /api/v1 form of Clarification.
+type ClarificationV1 struct {
+	Question string                  `json:"question"`
+	Field    string                  `json:"field"`
+	Options  []ClarificationOptionV1 `json:"options"`
+}
+
+// ClarificationOptionV1 is the /api/v1 form of ClarificationOption.
+type ClarificationOptionV1 struct {
+	Label   string         `json:"label"`
+	Context QueryContextV1 `json:"context"`
+}
+
+// QueryContextV1 is the /api/v1 form of QueryContext.
+type QueryContextV1 struct {
+	BoatClass string `json:"boat_class,omitempty"`
+	RacePhase string `json:"race_phase,omitempty"`
+	EventType string `json:"event_type,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+}
+
+// BatchAskResponseV1 is the /api/v1 form of BatchAskResponse.
+type BatchAskResponseV1 struct {
+	Results []BatchItemResultV1 `json:"results"`
+	Meta    BatchMetaV1         `json:"meta"`
+}
+
+// BatchItemResultV1 is the /api/v1 form of BatchItemResult.
+type BatchItemResultV1 struct {
+	Index         int                      `json:"index"`
+	ID            string                   `json:"id,omitempty"`
+	Status        int                      `json:"status"`
+	Response      *AskResponseV1           `json:"response,omitempty"`
+	Clarification *ClarificationResponseV1 `json:"clarification,omitempty"`
+	Error         *ErrorResponseV1         `json:"error,omitempty"`
+}
+
+// BatchMetaV1 is the /api/v1 form of BatchMeta.
+type BatchMetaV1 struct {
+	Total     int             `json:"total"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Usage     *UsageSummaryV1 `json:"usage,omitempty"`
+}
+
+// ErrorResponseV1 is the /api/v1 form of ErrorResponse.
+type ErrorResponseV1 struct {
+	Error   string `json:"error"`
+	Code    string `json:"code,omitempty"`
+	Details string `json:"details,omitempty"`
+}
+
+// TraceV1 is the /api/v1 form of Trace.
+type TraceV1 struct {
+	RequestID     string         `json:"request_id"`
+	PromptVersion string         `json:"prompt_version,omitempty"`
+	PromptVariant string         `json:"prompt_variant,omitempty"`
+	RetrievalMode RetrievalMode  `json:"retrieval_mode"`
+	TopK          int            `json:"top_k"`
+	HistoryTurns  int            `json:"history_turns,omitempty"`
+	Stages        []StageTraceV1 `json:"stages"`
+	Parts         []PartTraceV1  `json:"parts"`
+	Gate          *GateTraceV1   `json:"gate,omitempty"`
+	Usage         UsageSummaryV1 `json:"usage"`
+	RetrieveMS    int64          `json:"retrieve_ms"`
+	TotalMS       int64          `json:"total_ms"`
+}
+
+// StageTraceV1 is the /api/v1 form of StageTrace.
+type StageTraceV1 struct {
+	Stage      string        `json:"stage"`
+	Model      string        `json:"model,omitempty"`
+	Usage      *UsageV1      `json:"usage,omitempty"`
+	Prompt     *PromptSizeV1 `json:"prompt,omitempty"`
+	DurationMS int64         `json:"duration_ms"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// PartTraceV1 is the /api/v1 form of PartTrace.
+type PartTraceV1 struct {
+	Question   string             `json:"question"`
+	Rewrite    RewriteTraceV1     `json:"rewrite"`
+	Retrievals []RetrievalTraceV1 `json:"retrievals"`
+	RetrieveMS int64              `json:"retrieve_ms"`
+	Contexts   []ScoredContextV1  `json:"contexts"`
+	MaxScore   float64            `json:"max_score"`
+	PassedGate bool               `json:"passed_gate"`
+}
+
+// RewriteTraceV1 is the /api/v1 form of RewriteTrace.
+type RewriteTraceV1 struct {
+	QueryEN            string        `json:"q_en"`
+	KeywordsEN         []string      `json:"keywords_en,omitempty"`
+	QueryJA            string        `json:"q_ja,omitempty"`
+	HypotheticalEN     string        `json:"hypothetical_passage_en,omitempty"`
+	StandaloneQuestion string        `json:"standalone_question,omitempty"`
+	Model              string        `json:"model,omitempty"`
+	Usage              *UsageV1      `json:"usage,omitempty"`
+	Prompt             *PromptSizeV1 `json:"prompt,omitempty"`
+	DurationMS         int64         `json:"duration_ms"`
+}
+
+// RetrievalTraceV1 is the /api/v1 form of RetrievalTrace.
+type RetrievalTraceV1 struct {
+	Query   string            `json:"query"`
+	Results []ScoredContextV1 `json:"results"`
+}
+
+// ScoredContextV1 is the /api/v1 form of ScoredContext.
+type ScoredContextV1 struct {
+	RuleID       string  `json:"rule_id,omitempty"`
+	SectionTitle string  `json:"section_title,omitempty"`
+	SourceURI    string  `json:"source_uri,omitempty"`
+	Score        float64 `json:"score"`
+}
+
+// GateTraceV1 is the /api/v1 form of GateTrace.
+type GateTraceV1 struct {
+	Threshold float64 `json:"threshold"`
+	MaxScore  float64 `json:"max_score"`
+	Passed    bool    `json:"passed"`
+}
+
+// V1 converts the response to the /api/v1 contract.
+func (r *AskResponse) V1() *AskResponseV1 {
+	return &AskResponseV1{
+		Answer:     r.Answer,
+		Language:   r.Language,
+		AnswerJA:   r.AnswerJA,
+		Confidence: r.Confidence,
+		Citations: mapV1(r.Citations, func(c Citation) CitationV1 {
+			return CitationV1{
+				RuleID:       c.RuleID,
+				SectionTitle: c.SectionTitle,
+				QuoteEN:      c.QuoteEN,
+				SourceURL:    c.SourceURL,
+				Score:        c.Score,
+				SubQuestion:  c.SubQuestion,
+			}
+		}),
+		ConversationID: r.ConversationID,
+		Contexts: mapV1(r.Contexts, func(c ContextExcerpt) ContextExcerptV1 {
+			return ContextExcerptV1{
+				RuleID:       c.RuleID,
+				SectionTitle: c.SectionTitle,
+				SourceURI:    c.SourceURI,
+				Score:        c.Score,
+				Excerpt:      c.Excerpt,
+				PassedGate:   c.PassedGate,
+				SubQuestion:  c.SubQuestion,
+			}
+		}),
+		Meta:  r.Meta.v1(),
+		Debug: r.Debug.v1(),
+	}
+}
+
+// V1 converts the response to the /api/v1 contract.
+func (r *ClarificationResponse) V1() *ClarificationResponseV1 {
+	return &ClarificationResponseV1{
+		Clarification: ClarificationV1{
+			Question: r.Clarification.Question,
+			Field:    r.Clarification.Field,
+			Options: mapV1(r.Clarification.Options, func(o ClarificationOption) ClarificationOptionV1 {
+				return ClarificationOptionV1{
+					Label: o.Label,
+					Context: QueryContextV1{
+						BoatClass: o.Context.BoatClass,
+						RacePhase: o.Context.RacePhase,
+						EventType: o.Context.EventType,
+						Notes:     o.Context.Notes,
+					},
+				}
+			}),
+		},
+		Question:       r.Question,
+		Language:       r.Language,
+		ConversationID: r.ConversationID,
+		Meta:           r.Meta.v1(),
+		Debug:          r.Debug.v1(),
+	}
+}
+
+// V1 converts the response to the /api/v1 contract.
+func (r *BatchAskResponse) V1() *BatchAskResponseV1 {
+	results := mapV1(r.Results, func(item BatchItemResult) BatchItemResultV1 {
+		res := BatchItemResultV1{Index: item.Index, ID: item.ID, Status: item.Status}
+		if item.Response != nil {
+			res.Response = item.Response.V1()
+		}
+		if item.Clarification != nil {
+			res.Clarification = item.Clarification.V1()
+		}
+		if e := item.Error; e != nil {
+			res.Error = &ErrorResponseV1{Error: e.Error, Code: e.Code, Details: e.Details}
+		}
+		return res
+	})
+	return &BatchAskResponseV1{
+		Results: results,
+		Meta: BatchMetaV1{
+			Total:     r.Meta.Total,
+			Succeeded: r.Meta.Succeeded,
+			Failed:    r.Meta.Failed,
+			Usage:     r.Meta.Usage.v1(),
+		},
+	}
+}
+
+func (m Meta) v1() MetaV1 {
+	return MetaV1{
+		RAGCorpus:    m.RAGCorpus,
+		TopK:         m.TopK,
+		Warnings:     m.Warnings,
+		RewriteModel: m.RewriteModel,
+		AnswerModel:  m.AnswerModel,
+		SubQuestions: m.SubQuestions,
+		Usage:        m.Usage.v1(),
+	}
+}
+
+func (s *UsageSummary) v1() *UsageSummaryV1 {
+	if s == nil {
+		return nil
+	}
+	return &UsageSummaryV1{
+		PromptTokens:     s.PromptTokens,
+		CandidateTokens:  s.CandidateTokens,
+		CachedTokens:     s.CachedTokens,
+		ThoughtsTokens:   s.ThoughtsTokens,
+		EstimatedCostUSD: s.EstimatedCostUSD,
+	}
+}
+
+func (u *Usage) v1() *UsageV1 {
+	if u == nil {
+		return nil
+	}
+	return &UsageV1{
+		Model:           u.Model,
+		PromptTokens:    u.PromptTokens,
+		CandidateTokens: u.CandidateTokens,
+		CachedTokens:    u.CachedTokens,
+		ThoughtsTokens:  u.ThoughtsTokens,
+	}
+}
+
+func (p *PromptSize) v1() *PromptSizeV1 {
+	if p == nil {
+		return nil
+	}
+	return &PromptSizeV1{SystemChars: p.SystemChars, UserChars: p.UserChars}
+}
+
+func (t *Trace) v1() *TraceV1 {
+	if t == nil {
+		return nil
+	}
+	out := &TraceV1{
+		RequestID:     t.RequestID,
+		PromptVersion: t.PromptVersion,
+		PromptVariant: t.PromptVariant,
+		RetrievalMode: t.RetrievalMode,
+		TopK:          t.TopK,
+		HistoryTurns:  t.HistoryTurns,
+		Stages: mapV1(t.Stages, func(s StageTrace) StageTraceV1 {
+			return StageTraceV1{
+				Stage:      s.Stage,
+				Model:      s.Model,
+				Usage:      s.Usage.v1(),
+				Prompt:     s.Prompt.v1(),
+				DurationMS: s.DurationMS,
+				Error:      s.Error,
+			}
+		}),
+		Parts:      mapV1(t.Parts, PartTrace.v1),
+		Usage:      *t.Usage.v1(),
+		RetrieveMS: t.RetrieveMS,
+		TotalMS:    t.TotalMS,
+	}
+	if g := t.Gate; g != nil {
+		out.Gate = &GateTraceV1{Threshold: g.Threshold, MaxScore: g.MaxScore, Passed: g.Passed}
+	}
+	return out
+}
+
+func (p PartTrace) v1() PartTraceV1 {
+	rw := p.Rewrite
+	return PartTraceV1{
+		Question: p.Question,
+		Rewrite: RewriteTraceV1{
+			QueryEN:            rw.QueryEN,
+			KeywordsEN:         rw.KeywordsEN,
+			QueryJA:            rw.QueryJA,
+			HypotheticalEN:     rw.HypotheticalEN,
+			StandaloneQuestion: rw.StandaloneQuestion,
+			Model:              rw.Model,
+			Usage:              rw.Usage.v1(),
+			Prompt:             rw.Prompt.v1(),
+			DurationMS:         rw.DurationMS,
+		},
+		Retrievals: mapV1(p.Retrievals, func(r RetrievalTrace) RetrievalTraceV1 {
+			return RetrievalTraceV1{Query: r.Query, Results: mapV1(r.Results, ScoredContext.v1)}
+		}),
+		RetrieveMS: p.RetrieveMS,
+		Contexts:   mapV1(p.Contexts, ScoredContext.v1),
+		MaxScore:   p.MaxScore,
+		PassedGate: p.PassedGate,
+	}
+}
+
+func (c ScoredContext) v1() ScoredContextV1 {
+	return ScoredContextV1{RuleID: c.RuleID, SectionTitle: c.SectionTitle, SourceURI: c.SourceURI, Score: c.Score}
+}
+
+// mapV1 converts a slice element-wise, keeping nil as nil so that the
+// encoding ("null" or an omitted field) does not change.
+func mapV1[T, U any](in []T, f func(T) U) []U {
+	if in == nil {
+		return nil
+	}
+	out := make([]U, len(in))
+	for i, v := range in {
+		out[i] = f(v)
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// fullAskResponse sets every field that exists on the v1 contract, so the
+// golden file pins the whole v1 encoding.
+func fullAskResponse() *AskResponse {
+	usage := &Usage{Model: "gemini-2.5-flash", PromptTokens: 1000, CandidateTokens: 200, CachedTokens: 100, ThoughtsTokens: 50}
+	prompt := &PromptSize{SystemChars: 1200, UserChars: 800}
+	scored := []ScoredContext{{RuleID: "29.4", SectionTitle: "Penalties", SourceURI: "gs://rules/slalom.pdf", Score: 0.91}}
+	return &AskResponse{
+		Answer:     "ゲート接触は2秒のペナルティです。",
+		Language:   LangJA,
+		AnswerJA:   "ゲート接触は2秒のペナルティです。",
+		Confidence: 0.91,
+		Citations: []Citation{{
+			RuleID: "29.4", SectionTitle: "Penalties", QuoteEN: "A gate touch incurs a 2-second penalty.",
+			SourceURL: "https://www.canoeicf.com/rules", Score: 0.91, SubQuestion: 1,
+		}},
+		ConversationID: "conv_1",
+		Contexts: []ContextExcerpt{{
+			RuleID: "29.4", SectionTitle: "Penalties", SourceURI: "gs://rules/slalom.pdf", Score: 0.91,
+			Excerpt: "A gate touch incurs...", PassedGate: true, SubQuestion: 1,
+		}},
+		Meta: Meta{
+			RAGCorpus: "corpus", TopK: 8, Warnings: []string{"w"}, RewriteModel: "gemini-2.5-flash",
+			AnswerModel: "gemini-2.5-pro", SubQuestions: []string{"q1"},
+			Usage: &UsageSummary{PromptTokens: 1000, CandidateTokens: 200, CachedTokens: 100, ThoughtsTokens: 50, EstimatedCostUSD: 0.001},
+		},
+		Debug: &Trace{
+			RequestID: "req_1", PromptVersion: "3f9a1c0b2d4e", PromptVariant: "b", RetrievalMode: RetrievalHyDE, TopK: 8, HistoryTurns: 1,
+			Stages: []StageTrace{{Stage: "answer", Model: "gemini-2.5-pro", Usage: usage, Prompt: prompt, DurationMS: 900, Error: "e"}},
+			Parts: []PartTrace{{
+				Question: "ゲート接触は？",
+				Rewrite: RewriteTrace{
+					QueryEN: "gate touch penalty", KeywordsEN: []string{"gate"}, QueryJA: "ゲート接触", HypotheticalEN: "A touch...",
+					StandaloneQuestion: "ゲート接触は？", Model: "gemini-2.5-flash", Usage: usage, Prompt: prompt, DurationMS: 300,
+				},
+				Retrievals: []RetrievalTrace{{Query: "gate touch penalty", Results: scored}},
+				RetrieveMS: 150, Contexts: scored, MaxScore: 0.91, PassedGate: true,
+			}},
+			Gate:       &GateTrace{Threshold: 0.55, MaxScore: 0.91, Passed: true},
+			Usage:      UsageSummary{PromptTokens: 1000, CandidateTokens: 200, EstimatedCostUSD: 0.001},
+			RetrieveMS: 150,
+			TotalMS:    1400,
+		},
+	}
+}
+
+func TestV1_Golden(t *testing.T) {
+	clarification := &ClarificationResponse{
+		Clarification: Clarification{Question: "艇種は？", Field: "boat_class", Options: []ClarificationOption{
+			{Label: "K1", Context: QueryContext{BoatClass: "K1", RacePhase: "final", EventType: "world_cup", Notes: "n"}},
+		}},
+		Question: "ゲート接触は？", Language: LangJA, ConversationID: "conv_1",
+		Meta:  Meta{RAGCorpus: "corpus", TopK: 8, Warnings: []string{}},
+		Debug: &Trace{RequestID: "req_1"},
+	}
+	batch := &BatchAskResponse{
+		Results: []BatchItemResult{
+			{Index: 0, ID: "a", Status: 200, Response: &AskResponse{Citations: []Citation{}, Meta: Meta{Warnings: []string{}}}},
+			{Index: 1, ID: "b", Status: 400, Error: &ErrorResponse{Error: "invalid", Code: "validation", Details: "question"}},
+		},
+		Meta: BatchMeta{Total: 2, Succeeded: 1, Failed: 1, Usage: &UsageSummary{PromptTokens: 10}},
+	}
+
+	got, err := json.MarshalIndent(map[string]any{
+		"ask":           fullAskResponse().V1(),
+		"clarification": clarification.V1(),
+		"batch":         batch.V1(),
+	}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	const golden = "testdata/v1_responses.golden.json"
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the v1 encoding changed; v1 is frozen. Got:\n%s", got)
+	}
+}
@@ -0,0 +1,41 @@
+package feedback
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// JSONLStore appends feedback to a JSON Lines file, one Entry per line.
+type JSONLStore struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenJSONL opens (creating if needed) the file at path for appending.
+func OpenJSONL(path string) (*JSONLStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open feedback file: %w", err)
+	}
+	return &JSONLStore{f: f}, nil
+}
+
+func (s *JSONLStore) Save(_ context.Context, e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write feedback: %w", err)
+	}
+	return nil
+}
+
+func (s *JSONLStore) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,62 @@
+package feedback
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+)
+
+// SQLiteDriver is the database/sql driver name SQLiteStore opens. As for
+// conversations, the driver is registered by the binary (see cmd/api).
+const SQLiteDriver = "sqlite3"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS feedback (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	request_id      TEXT    NOT NULL,
+	rating          TEXT    NOT NULL,
+	comment         TEXT    NOT NULL DEFAULT '',
+	correct_rule_id TEXT    NOT NULL DEFAULT '',
+	prompt_version  TEXT    NOT NULL DEFAULT '',
+	prompt_variant  TEXT    NOT NULL DEFAULT '',
+	created_at      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS feedback_by_request ON feedback (request_id);
+`
+
+// SQLiteStore keeps feedback in a SQLite database file.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens (creating if needed) the database at path.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	if !slices.Contains(sql.Drivers(), SQLiteDriver) {
+		return nil, fmt.Errorf("sqlite driver %q is not registered (build with CGO_ENABLED=1)", SQLiteDriver)
+	}
+	db, err := sql.Open(SQLiteDriver, path)
+	if err != nil {
+		return nil, fmt.Errorf("open feedback db: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create feedback schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Save(ctx context.Context, e Entry) error {
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO feedback (request_id, rating, comment, correct_rule_id, prompt_version, prompt_variant, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.RequestID, string(e.Rating), e.Comment, e.CorrectRuleID, e.PromptVersion, e.PromptVariant, e.CreatedAt.UnixMilli()); err != nil {
+		return fmt.Errorf("save feedback: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,35 @@
+//go:build cgo
+
+package feedback
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSQLiteStore_SavesEntries(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "feedback.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	want := testEntry("1-1")
+	if err := s.Save(context.Background(), want); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Entry
+	var created int64
+	err = s.db.QueryRow(`SELECT request_id, rating, comment, correct_rule_id, prompt_version, prompt_variant, created_at FROM feedback`).
+		Scan(&got.RequestID, &got.Rating, &got.Comment, &got.CorrectRuleID, &got.PromptVersion, &got.PromptVariant, &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RequestID != want.RequestID || got.Rating != want.Rating || got.Comment != want.Comment ||
+		got.CorrectRuleID != want.CorrectRuleID || got.PromptVersion != want.PromptVersion || got.PromptVariant != want.PromptVariant || created != want.CreatedAt.UnixMilli() {
+		t.Errorf("got %+v (created %d), want %+v", got, created, want)
+	}
+}
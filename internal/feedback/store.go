@@ -0,0 +1,29 @@
+// Package feedback stores officials' ratings of answers, the raw material
+// for evaluation sets and prompt tuning.
+package feedback
+
+import (
+	"context"
+	"time"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// Entry is one stored piece of feedback.
+type Entry struct {
+	RequestID     string                `json:"request_id"`
+	Rating        domain.FeedbackRating `json:"rating"`
+	Comment       string                `json:"comment,omitempty"`
+	CorrectRuleID string                `json:"correct_rule_id,omitempty"`
+	// PromptVersion and PromptVariant are the prompts that produced the rated
+	// answer, so ratings can be compared per variant.
+	PromptVersion string    `json:"prompt_version,omitempty"`
+	PromptVariant string    `json:"prompt_variant,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Store is a feedback store.
+type Store interface {
+	Save(ctx context.Context, e Entry) error
+	Close() error
+}
@@ -0,0 +1,57 @@
+package feedback
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+func testEntry(requestID string) Entry {
+	return Entry{
+		RequestID:     requestID,
+		Rating:        domain.RatingWrong,
+		Comment:       "29.4 ではなく 29.5",
+		CorrectRuleID: "29.5",
+		PromptVersion: "3f9a1c0b2d4e",
+		PromptVariant: "concise",
+		CreatedAt:     time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestJSONLStore_AppendsEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.jsonl")
+	for _, id := range []string{"1-1", "1-2"} {
+		// Reopening must append, not truncate.
+		s, err := OpenJSONL(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Save(context.Background(), testEntry(id)); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []Entry
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 2 || got[1].RequestID != "1-2" || got[0] != testEntry("1-1") {
+		t.Errorf("unexpected entries: %+v", got)
+	}
+}
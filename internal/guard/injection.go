@@ -0,0 +1,172 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/logging"
+)
+
+// Mode controls what happens to a question flagged as a prompt injection.
+type Mode string
+
+const (
+	// ModeReject rejects the request with an injection error.
+	ModeReject Mode = "reject"
+	// ModeNeutralize removes the matched spans and continues. Questions flagged
+	// only by the classifier have no span to remove and are rejected.
+	ModeNeutralize Mode = "neutralize"
+	// ModeLog only logs hits; the question is passed through unchanged.
+	ModeLog Mode = "log"
+)
+
+// ParseMode validates a mode string.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeReject, ModeNeutralize, ModeLog:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown injection mode %q (want reject, neutralize or log)", s)
+}
+
+// Rule is a named pattern that indicates an injection attempt.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultRules covers common instruction-override phrasings in English and Japanese.
+// Rulebook questions talk about ignoring rules, earlier rules and officials'
+// instructions, and about officials acting as one another, so the patterns
+// only match text addressed to the model: "your rules", "previous
+// instructions", imperatives like 無視して, and あなた/you.
+var DefaultRules = []Rule{
+	{"en_ignore_instructions", regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b[^.\n]{0,30}?\b(your\s+(\w+\s+)?(instructions?|prompts?|rules|directions|guidelines)|(previous|prior|above|earlier|preceding|system)\s+(instructions?|prompts?|directions))\b`)},
+	{"en_reveal_prompt", regexp.MustCompile(`(?i)\b(reveal|show|print|repeat|output)\b[^.\n]{0,30}\b(system|hidden|initial)\s+(prompt|instructions?|message)`)},
+	{"en_role_override", regexp.MustCompile(`(?i)\b(you are now|from now on,? you( are|'re| will|'ll)|pretend (to be|you are)|roleplay as|act as an? (unrestricted|unfiltered|uncensored|jailbroken))\b`)},
+	{"en_jailbreak", regexp.MustCompile(`(?i)\b(jailbreak|developer mode|DAN mode|do anything now)\b`)},
+	{"en_fake_role_tag", regexp.MustCompile(`(?i)(^|\n)\s*(system|assistant)\s*:|<\s*/?\s*(system|instructions?)\s*>`)},
+	{"ja_ignore_instructions", regexp.MustCompile(`((あなた|お前)(への|に与えられた|の)[^。\n]{0,6}?(指示|命令|ルール|設定|プロンプト|制約)|(これまで|今まで|以前|上記|先程|先ほど|最初|全て|すべて)の?(指示|命令|プロンプト))[^。\n]{0,10}(を|は)?[^。\n]{0,5}(無視(して|しろ|せよ)|忘れ(て|ろ)|破棄(して|しろ|せよ)|リセット(して|しろ|せよ))`)},
+	{"ja_reveal_prompt", regexp.MustCompile(`(システム|隠れた|内部の?|初期)(プロンプト|指示|命令)[^。\n]{0,15}(教え|表示|出力|見せ|開示|繰り返)`)},
+	{"ja_role_override", regexp.MustCompile(`(あなたは|お前は)(今から|これから|今後)|(あなた|お前)(は|が)[^。\n]{0,20}として(振る舞|ふるま|行動)`)},
+	{"ja_jailbreak", regexp.MustCompile(`脱獄|ジェイルブレイク|開発者モード|制約を(解除|外|無視)`)},
+}
+
+// Classifier is an optional model-based check run when no rule matches.
+type Classifier interface {
+	ClassifyInjection(ctx context.Context, text string) (*domain.InjectionVerdict, error)
+}
+
+// Result describes the outcome of a check.
+type Result struct {
+	// Hits lists the names of matched rules, plus "classifier" if the classifier flagged it.
+	Hits []string
+	// Question is the text to continue with (neutralized in ModeNeutralize).
+	Question string
+	// Neutralized reports whether Question differs from the input.
+	Neutralized bool
+	// Verdict is the classifier's answer, or nil if it was not consulted or failed.
+	Verdict *domain.InjectionVerdict
+}
+
+// Detector checks incoming questions for prompt injection.
+type Detector struct {
+	rules      []Rule
+	classifier Classifier
+	mode       Mode
+}
+
+// NewDetector creates a detector with DefaultRules. classifier may be nil.
+func NewDetector(mode Mode, classifier Classifier) *Detector {
+	return &Detector{rules: DefaultRules, classifier: classifier, mode: mode}
+}
+
+// Check inspects question. It returns an injection AppError when the
+// question must be rejected, and otherwise the question to continue with.
+func (d *Detector) Check(ctx context.Context, question string) (*Result, error) {
+	res := &Result{Question: question}
+
+	var spans [][]int
+	for _, r := range d.rules {
+		locs := r.Pattern.FindAllStringIndex(question, -1)
+		if len(locs) > 0 {
+			res.Hits = append(res.Hits, r.Name)
+			spans = append(spans, locs...)
+		}
+	}
+
+	if len(res.Hits) == 0 && d.classifier != nil {
+		verdict, err := d.classifier.ClassifyInjection(ctx, question)
+		if err != nil {
+			// Fail open: the classifier is a best-effort second line.
+			slog.WarnContext(ctx, "injection classifier failed",
+				"request_id", logging.RequestID(ctx), "error", err)
+		} else {
+			res.Verdict = verdict
+			if verdict.Injection {
+				res.Hits = append(res.Hits, "classifier")
+				slog.InfoContext(ctx, "injection classifier verdict",
+					"request_id", logging.RequestID(ctx), "reason", verdict.Reason)
+			}
+		}
+	}
+
+	if len(res.Hits) == 0 {
+		return res, nil
+	}
+
+	action := string(d.mode)
+	if d.mode == ModeNeutralize {
+		if len(spans) == 0 {
+			action = string(ModeReject)
+		} else {
+			res.Question = removeSpans(question, spans)
+			res.Neutralized = true
+			if strings.TrimSpace(res.Question) == "" {
+				action = string(ModeReject)
+			}
+		}
+	}
+
+	slog.WarnContext(ctx, "prompt injection detected",
+		"request_id", logging.RequestID(ctx),
+		"rules", res.Hits,
+		"mode", string(d.mode),
+		"action", action,
+		"question", truncateRunes(question, 200),
+	)
+
+	if action == string(ModeReject) {
+		return nil, domain.NewInjectionError(res.Hits)
+	}
+	return res, nil
+}
+
+// removeSpans deletes the given byte ranges (which may overlap) from s.
+func removeSpans(s string, spans [][]int) string {
+	drop := make([]bool, len(s))
+	for _, sp := range spans {
+		for i := sp[0]; i < sp[1]; i++ {
+			drop[i] = true
+		}
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if !drop[i] {
+			b.WriteByte(s[i])
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
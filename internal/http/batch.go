@@ -0,0 +1,152 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/logging"
+)
+
+// DefaultBatchConcurrency is how many questions of a batch run at once
+// unless configured.
+const DefaultBatchConcurrency = 4
+
+// AskBatch serves /api/v2/ask/batch. It answers up to
+// Config.BatchMaxQuestions questions through the same pipeline as Ask, with
+// bounded concurrency. Each question costs one rate limit token; questions
+// beyond the available tokens start as their tokens become available. A
+// failed question yields a per-item error; the batch itself only fails on an
+// invalid body or the rate limit.
+func (h *Handler) AskBatch(c echo.Context) error {
+	return h.askBatch(c, apiV2)
+}
+
+func (h *Handler) askBatch(c echo.Context, v apiVersion) error {
+	ctx := c.Request().Context()
+	reqID := logging.RequestID(ctx)
+	start := time.Now()
+
+	var req domain.BatchAskRequest
+	if err := c.Bind(&req); err != nil {
+		return respondAppError(c, domain.NewValidationError("invalid JSON body"))
+	}
+	maxQuestions := h.cfg.BatchMaxQuestions
+	if maxQuestions <= 0 {
+		maxQuestions = domain.DefaultBatchMaxQuestions
+	}
+	if err := req.Validate(maxQuestions); err != nil {
+		return respondAppError(c, err)
+	}
+	if req.Options != nil && req.Options.Debug && !h.debugAllowed(c) {
+		return respondAppError(c, domain.NewUnauthorizedError())
+	}
+	// The middleware charged one token, for the first question; each
+	// question runs a full pipeline.
+	starts, err := reserveRateLimit(c, len(req.Questions)-1)
+	if err != nil {
+		return respondAppError(c, err)
+	}
+	starts = append([]time.Time{{}}, starts...)
+	concurrency := h.cfg.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	results := make([]domain.BatchItemResult, len(req.Questions))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range req.Questions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Wait for the question's rate limit token before taking a slot,
+			// so questions that may start now are not held up.
+			if err := waitUntil(ctx, starts[i]); err != nil {
+				results[i] = batchItemError(i, req.Questions[i].ID, batchItemID(reqID, i), domain.NewInternalError("batch cancelled", err))
+				return
+			}
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				results[i] = h.answerBatchItem(ctx, reqID, &req, i)
+			case <-ctx.Done():
+				// The client is gone; don't start the remaining questions.
+				results[i] = batchItemError(i, req.Questions[i].ID, batchItemID(reqID, i), domain.NewInternalError("batch cancelled", ctx.Err()))
+			}
+		}()
+	}
+	wg.Wait()
+
+	resp := domain.BatchAskResponse{Results: results, Meta: domain.BatchMeta{Total: len(results)}}
+	if h.cfg.ExposeUsage {
+		resp.Meta.Usage = &domain.UsageSummary{}
+	}
+	for _, r := range results {
+		if r.Error != nil {
+			resp.Meta.Failed++
+		} else {
+			resp.Meta.Succeeded++
+		}
+		if resp.Meta.Usage != nil {
+			resp.Meta.Usage.Merge(itemUsage(r))
+		}
+	}
+
+	slog.InfoContext(ctx, "batch answered",
+		"request_id", reqID,
+		"total", resp.Meta.Total,
+		"succeeded", resp.Meta.Succeeded,
+		"failed", resp.Meta.Failed,
+		"concurrency", concurrency,
+		"total_ms", time.Since(start).Milliseconds(),
+	)
+	return c.JSON(http.StatusOK, v.batchResponse(&resp))
+}
+
+// answerBatchItem runs one question under its own request ID, so logs,
+// prompt variants, conversation turns and feedback are per question.
+func (h *Handler) answerBatchItem(ctx context.Context, batchID string, batch *domain.BatchAskRequest, i int) domain.BatchItemResult {
+	itemID := batchItemID(batchID, i)
+	ctx = logging.WithRequestID(ctx, itemID)
+	req := batch.AskRequest(i)
+	resp, clarification, _, err := h.answer(ctx, &req)
+	if err != nil {
+		return batchItemError(i, batch.Questions[i].ID, itemID, err)
+	}
+
+	return domain.BatchItemResult{
+		Index:         i,
+		ID:            batch.Questions[i].ID,
+		RequestID:     itemID,
+		Status:        http.StatusOK,
+		Response:      resp,
+		Clarification: clarification,
+	}
+}
+
+// batchItemID is the request ID of the i-th question: "<batch id>.<n>".
+func batchItemID(batchID string, i int) string {
+	return fmt.Sprintf("%s.%d", batchID, i+1)
+}
+
+func batchItemError(i int, id, requestID string, err error) domain.BatchItemResult {
+	status, errResp := appErrorResponse(err)
+	return domain.BatchItemResult{Index: i, ID: id, RequestID: requestID, Status: status, Error: &errResp}
+}
+
+func itemUsage(r domain.BatchItemResult) *domain.UsageSummary {
+	switch {
+	case r.Response != nil:
+		return r.Response.Meta.Usage
+	case r.Clarification != nil:
+		return r.Clarification.Meta.Usage
+	}
+	return nil
+}
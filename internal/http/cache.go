@@ -0,0 +1,119 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/shunpei/rulegate/internal/answercache"
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// cacheInfo describes the answer cache entry a result was served from or
+// stored as. The zero value means the result is not cached.
+type cacheInfo struct {
+	hit     bool
+	etag    string
+	expires time.Time
+}
+
+// cacheKey returns the answer cache key of a validated request. Requests
+// that continue a conversation or ask for a debug trace are never cached.
+func (h *Handler) cacheKey(ctx context.Context, req *domain.AskRequest, scope answercache.Scope, logFields []any) (answercache.Key, bool) {
+	if h.cfg.AnswerCache == nil || req.ConversationID != "" || req.DebugRequested() {
+		return answercache.Key{}, false
+	}
+	scope.Language = req.Language
+	scope.Context = req.Context
+	scope.Clarification = req.Clarification
+	scope.Decompose = req.EffectiveDecompose(h.cfg.Decompose)
+	scope.AllowClarification = req.ClarificationAllowed()
+	scope.ReturnContexts = req.ContextsRequested()
+	if req.Options != nil {
+		scope.AnswerStyle = req.Options.AnswerStyle
+	}
+	key, err := h.cfg.AnswerCache.Key(ctx, scope, req.Question)
+	if err != nil {
+		slog.WarnContext(ctx, "answer cache bypassed", append(logFields, "error", err)...)
+		return answercache.Key{}, false
+	}
+	return key, true
+}
+
+// cachedAnswer looks the request up in the answer cache. A hit costs only the
+// tokens already in usage (injection screening) and, with conversations
+// enabled, starts a new conversation like a freshly generated answer would.
+func (h *Handler) cachedAnswer(ctx context.Context, key answercache.Key, req *domain.AskRequest, usage *domain.UsageSummary, logFields []any) (*domain.AskResponse, *domain.ClarificationResponse, cacheInfo, bool) {
+	hit, ok := h.cfg.AnswerCache.Get(ctx, key)
+	if !ok {
+		return nil, nil, cacheInfo{}, false
+	}
+	info := cacheInfo{hit: true, etag: hit.ETag, expires: hit.Expires}
+	slog.InfoContext(ctx, "answer served from cache",
+		append(logFields, "etag", hit.ETag, "similarity", hit.Similarity, "cached_question", hit.Question)...)
+
+	// A semantic match answers a differently worded question; say which.
+	var warnings []string
+	if hit.Similarity < 1 {
+		warnings = append(warnings, fmt.Sprintf("similar_question: answered from the cached answer to %q", hit.Question))
+	}
+
+	if hit.Clarification != nil {
+		hit.Clarification.Meta.Warnings = append(hit.Clarification.Meta.Warnings, warnings...)
+		if h.cfg.ExposeUsage {
+			hit.Clarification.Meta.Usage = usage
+		}
+		return nil, hit.Clarification, info, true
+	}
+	resp := hit.Response
+	convID, _, _ := h.loadConversation(ctx, req, logFields)
+	h.saveTurn(ctx, convID, req, "", resp.Answer, resp.Citations, logFields)
+	resp.ConversationID = convID
+	resp.Meta.Warnings = append(resp.Meta.Warnings, warnings...)
+	if h.cfg.ExposeUsage {
+		resp.Meta.Usage = usage
+	}
+	return resp, nil, info, true
+}
+
+// storeAnswer caches a pipeline result. The conversation ID is per request
+// and not stored.
+func (h *Handler) storeAnswer(ctx context.Context, key answercache.Key, resp *domain.AskResponse, clarification *domain.ClarificationResponse, logFields []any) cacheInfo {
+	if resp != nil {
+		stored := *resp
+		stored.ConversationID = ""
+		resp = &stored
+	}
+	etag, expires, err := h.cfg.AnswerCache.Put(ctx, key, resp, clarification)
+	if err != nil {
+		slog.WarnContext(ctx, "answer not cached", append(logFields, "error", err)...)
+		return cacheInfo{}
+	}
+	return cacheInfo{etag: etag, expires: expires}
+}
+
+// setCacheHeaders describes the cache entry behind a response. Clients compare
+// ETags to tell whether an answer changed; the API is POST-only, so
+// If-None-Match is not honoured. ETags differ per API version because the
+// rendered bodies do.
+func (h *Handler) setCacheHeaders(c echo.Context, info cacheInfo, v apiVersion) {
+	if h.cfg.AnswerCache == nil {
+		return
+	}
+	header := c.Response().Header()
+	if info.etag == "" {
+		header.Set("Cache-Control", "no-store")
+		return
+	}
+	maxAge := max(0, int(time.Until(info.expires).Seconds()))
+	header.Set("ETag", fmt.Sprintf(`"%s-v%d"`, info.etag, v))
+	header.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+	if info.hit {
+		header.Set("X-Cache", "HIT")
+	} else {
+		header.Set("X-Cache", "MISS")
+	}
+}
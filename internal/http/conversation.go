@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/shunpei/rulegate/internal/conversation"
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// loadConversation resolves the request's conversation: its ID (a new one
+// when the request has none) and earlier turns. Store failures only cost the
+// history; they are logged and surfaced as warnings.
+func (h *Handler) loadConversation(ctx context.Context, req *domain.AskRequest, logFields []any) (id string, history []domain.Turn, warnings []string) {
+	if h.cfg.Conversations == nil {
+		if req.ConversationID != "" {
+			warnings = append(warnings, "conversations_disabled: conversation_id was ignored")
+		}
+		return "", nil, warnings
+	}
+	if req.ConversationID == "" {
+		return conversation.NewID(), nil, nil
+	}
+
+	history, err := h.cfg.Conversations.History(ctx, req.ConversationID)
+	switch {
+	case errors.Is(err, conversation.ErrNotFound):
+		warnings = append(warnings, "conversation_not_found: the conversation expired or is unknown; answered without history")
+	case err != nil:
+		slog.WarnContext(ctx, "conversation history unavailable", append(logFields, "error", err)...)
+		warnings = append(warnings, "conversation_unavailable: answered without history")
+	}
+	return req.ConversationID, history, warnings
+}
+
+// saveTurn appends the answered question to the conversation. Failures are
+// logged; the answer is returned regardless.
+func (h *Handler) saveTurn(ctx context.Context, id string, req *domain.AskRequest, standalone, answer string, citations []domain.Citation, logFields []any) {
+	if h.cfg.Conversations == nil || id == "" {
+		return
+	}
+	turn := domain.Turn{
+		Question:           req.Question,
+		StandaloneQuestion: standalone,
+		Answer:             answer,
+		Context:            req.Context,
+	}
+	for _, c := range citations {
+		turn.Citations = append(turn.Citations, domain.TurnCitation{RuleID: c.RuleID, SectionTitle: c.SectionTitle})
+	}
+	if err := h.cfg.Conversations.Append(ctx, id, turn); err != nil {
+		slog.WarnContext(ctx, "conversation turn not saved", append(logFields, "error", err)...)
+	}
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/feedback"
+	"github.com/shunpei/rulegate/internal/logging"
+)
+
+// Feedback stores an official's rating of an earlier answer, identified by
+// that answer's request ID.
+func (h *Handler) Feedback(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req domain.FeedbackRequest
+	if err := c.Bind(&req); err != nil {
+		return respondAppError(c, domain.NewValidationError("invalid JSON body"))
+	}
+	if err := req.Validate(); err != nil {
+		return respondAppError(c, err)
+	}
+
+	entry := feedback.Entry{
+		RequestID:     req.RequestID,
+		Rating:        req.Rating,
+		Comment:       req.Comment,
+		CorrectRuleID: req.CorrectRuleID,
+		PromptVersion: req.PromptVersion,
+		PromptVariant: req.PromptVariant,
+		CreatedAt:     time.Now().UTC(),
+	}
+	// The prompts may have been reloaded or the experiment changed since the
+	// answer, so the answer's meta is preferred. Clients without it (v1)
+	// get the variant assignment recomputed from the request ID, against
+	// the current prompts.
+	if entry.PromptVersion == "" && h.cfg.Prompts != nil {
+		pt := h.cfg.Prompts.ForRequest(req.RequestID)
+		entry.PromptVersion, entry.PromptVariant = pt.Version, pt.Variant
+	}
+
+	if err := h.cfg.Feedback.Save(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "feedback not stored",
+			"request_id", logging.RequestID(ctx), "answer_request_id", req.RequestID, "error", err)
+		return respondAppError(c, domain.NewInternalError("failed to store feedback", err))
+	}
+
+	slog.InfoContext(ctx, "feedback recorded",
+		"request_id", logging.RequestID(ctx),
+		"answer_request_id", req.RequestID,
+		"rating", string(req.Rating),
+		"correct_rule_id", req.CorrectRuleID,
+		"prompt_version", entry.PromptVersion,
+		"prompt_variant", entry.PromptVariant,
+	)
+	return c.JSON(http.StatusCreated, domain.FeedbackResponse{Status: "recorded"})
+}
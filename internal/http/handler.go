@@ -1,17 +1,24 @@
 package http
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/shunpei/rulegate/internal/answercache"
+	"github.com/shunpei/rulegate/internal/conversation"
 	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/feedback"
+	"github.com/shunpei/rulegate/internal/guard"
 	"github.com/shunpei/rulegate/internal/llm"
 	"github.com/shunpei/rulegate/internal/logging"
+	"github.com/shunpei/rulegate/internal/openapi"
 	"github.com/shunpei/rulegate/internal/rag"
 )
 
@@ -21,13 +28,50 @@ type Config struct {
 	DefaultMinConf float64
 	SourceURL      string
 	RAGCorpusID    string
+
+	// Prices is used to estimate per-request LLM cost.
+	Prices llm.PriceTable
+	// ExposeUsage adds token usage and estimated cost to Meta.
+	ExposeUsage bool
+	// Injection screens questions before the rewrite; nil disables it.
+	Injection *guard.Detector
+	// Prompts is pinned per request so a reload never mixes prompt versions.
+	Prompts *llm.PromptStore
+	// AdminToken enables the /admin endpoints; empty disables them.
+	AdminToken string
+	// RetrievalMode is the default retrieval query mode; empty means query.
+	RetrievalMode domain.RetrievalMode
+	// ScoreMetric is what the retriever's scores measure; empty means
+	// similarity.
+	ScoreMetric rag.ScoreMetric
+	// Decompose splits compound questions into sub-questions by default.
+	Decompose bool
+	// Conversations stores turns for follow-up questions; nil disables
+	// conversations.
+	Conversations conversation.Store
+	// Feedback stores ratings posted to /api/feedback; nil disables the
+	// endpoint.
+	Feedback feedback.Store
+	// AnswerCache serves repeated questions without running the pipeline;
+	// nil disables caching.
+	AnswerCache *answercache.Cache
+	// BatchMaxQuestions and BatchConcurrency bound /api/ask/batch; <= 0
+	// means the defaults.
+	BatchMaxQuestions int
+	BatchConcurrency  int
+	// ReadyCacheTTL and ReadyTimeout tune /readyz; <= 0 means the defaults.
+	ReadyCacheTTL time.Duration
+	ReadyTimeout  time.Duration
+	// MaxBodyBytes bounds request bodies; <= 0 means DefaultMaxBodyBytes.
+	MaxBodyBytes int64
 }
 
-// Handler implements the /api/ask and /healthz endpoints.
+// Handler implements the /api/ask, /healthz and /readyz endpoints.
 type Handler struct {
 	retriever rag.Retriever
 	llm       llm.LLM
 	cfg       Config
+	ready     readiness
 }
 
 func NewHandler(retriever rag.Retriever, llmClient llm.LLM, cfg Config) *Handler {
@@ -38,102 +82,334 @@ func NewHandler(retriever rag.Retriever, llmClient llm.LLM, cfg Config) *Handler
 	}
 }
 
+// Healthz reports that the process is up. It checks no dependencies; see
+// Readyz.
 func (h *Handler) Healthz(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
 }
 
+// debugAllowed reports whether the request carries the admin token, which
+// debug traces require. Without a configured token debugging is disabled.
+func (h *Handler) debugAllowed(c echo.Context) bool {
+	return h.cfg.AdminToken != "" && validBearer(c.Request().Header.Get("Authorization"), h.cfg.AdminToken)
+}
+
+// OpenAPI serves the API document.
+func (h *Handler) OpenAPI(c echo.Context) error {
+	return c.JSON(http.StatusOK, openapi.Spec())
+}
+
+// Ask serves /api/v2/ask.
 func (h *Handler) Ask(c echo.Context) error {
-	ctx := c.Request().Context()
-	reqID := logging.RequestID(ctx)
-	totalStart := time.Now()
+	return h.ask(c, apiV2)
+}
 
+func (h *Handler) ask(c echo.Context, v apiVersion) error {
 	// Parse request body.
 	var req domain.AskRequest
 	if err := c.Bind(&req); err != nil {
 		return respondAppError(c, domain.NewValidationError("invalid JSON body"))
 	}
+	if req.DebugRequested() && !h.debugAllowed(c) {
+		return respondAppError(c, domain.NewUnauthorizedError())
+	}
+
+	resp, clarification, cached, err := h.answer(c.Request().Context(), &req)
+	if err != nil {
+		return respondAppError(c, err)
+	}
+	h.setCacheHeaders(c, cached, v)
+	if clarification != nil {
+		return c.JSON(http.StatusOK, v.clarificationResponse(clarification))
+	}
+	return c.JSON(http.StatusOK, v.askResponse(resp))
+}
+
+// screenInjection runs the injection check on every user-supplied string
+// that reaches a prompt: the question and the context fields, which by now
+// include the clarification choices. Neutralized text replaces the input.
+// Classifier calls are added to usage and trace.
+func (h *Handler) screenInjection(ctx context.Context, req *domain.AskRequest, usage *domain.UsageSummary, trace *domain.Trace) ([]string, error) {
+	if h.cfg.Injection == nil {
+		return nil, nil
+	}
+	type input struct {
+		text    *string
+		warning string
+	}
+	inputs := []input{{&req.Question, "question_neutralized: instruction-like text was removed from the question"}}
+	if qc := req.Context; qc != nil {
+		for _, f := range []struct {
+			name string
+			text *string
+		}{{"boat_class", &qc.BoatClass}, {"race_phase", &qc.RacePhase}, {"event_type", &qc.EventType}, {"notes", &qc.Notes}} {
+			inputs = append(inputs, input{f.text, "context_neutralized: instruction-like text was removed from context." + f.name})
+		}
+	}
+
+	var warnings []string
+	for _, in := range inputs {
+		if *in.text == "" {
+			continue
+		}
+		start := time.Now()
+		screened, err := h.cfg.Injection.Check(ctx, *in.text)
+		if err != nil {
+			return nil, err
+		}
+		if v := screened.Verdict; v != nil {
+			h.addUsage(usage, v.Usage)
+			trace.AddStage(domain.StageTrace{Stage: "injection_classifier", Model: v.Model, Usage: v.Usage, Prompt: v.Prompt, DurationMS: time.Since(start).Milliseconds()})
+		}
+		if screened.Neutralized {
+			*in.text = screened.Question
+			warnings = append(warnings, in.warning)
+		}
+	}
+	return warnings, nil
+}
+
+// answer validates req and runs the question-answering pipeline, or serves
+// it from the answer cache. It returns either an answer (possibly "not
+// found") or a clarification request.
+func (h *Handler) answer(ctx context.Context, req *domain.AskRequest) (*domain.AskResponse, *domain.ClarificationResponse, cacheInfo, error) {
+	reqID := logging.RequestID(ctx)
+	totalStart := time.Now()
 
 	// Validate.
 	if err := req.Validate(); err != nil {
-		return respondAppError(c, err)
+		return nil, nil, cacheInfo{}, err
+	}
+
+	promptVersion, promptVariant := "", ""
+	if h.cfg.Prompts != nil {
+		pt := h.cfg.Prompts.ForRequest(reqID)
+		ctx = llm.WithPrompts(ctx, pt)
+		promptVersion, promptVariant = pt.Version, pt.Variant
 	}
 
 	topK := req.EffectiveTopK(h.cfg.DefaultTopK)
 	minConf := req.EffectiveMinConfidence(h.cfg.DefaultMinConf)
-	corpusID := h.cfg.RAGCorpusID
+	retrievalMode := req.EffectiveRetrievalMode(h.cfg.RetrievalMode)
+	if retrievalMode == "" {
+		retrievalMode = domain.RetrievalQuery
+	}
 
 	logFields := []any{
 		"request_id", reqID,
 		"discipline", req.Discipline,
 		"rule_edition", req.RuleEdition,
+		"language", string(req.Language),
 		"top_k", topK,
 		"min_confidence", minConf,
+		"retrieval_mode", string(retrievalMode),
+		"prompt_version", promptVersion,
+		"prompt_variant", promptVariant,
+	}
+
+	warnings := []string{}
+	usage := &domain.UsageSummary{}
+
+	// The debug trace is nil unless requested (Ask checks the admin token).
+	var trace *domain.Trace
+	if req.DebugRequested() {
+		trace = &domain.Trace{
+			RequestID:     reqID,
+			PromptVersion: promptVersion,
+			PromptVariant: promptVariant,
+			RetrievalMode: retrievalMode,
+			TopK:          topK,
+		}
 	}
 
-	// Step 1: Query rewrite (JA → EN).
-	rewriteStart := time.Now()
-	rewritten, err := h.llm.RewriteQuery(ctx, req.QuestionJA, req.Context)
-	rewriteLatency := time.Since(rewriteStart)
+	// Step 0: Prompt injection screening.
+	screenWarnings, err := h.screenInjection(ctx, req, usage, trace)
 	if err != nil {
-		slog.ErrorContext(ctx, "rewrite failed", append(logFields, "error", err)...)
-		return respondAppError(c, domain.NewVertexError("query rewrite failed", err))
+		return nil, nil, cacheInfo{}, err
 	}
+	warnings = append(warnings, screenWarnings...)
 
-	slog.InfoContext(ctx, "query rewritten",
-		append(logFields, "q_en", rewritten.QueryEN, "rewrite_ms", rewriteLatency.Milliseconds())...,
-	)
+	// Answer cache, keyed on the screened question.
+	corpus := rag.CorpusName(h.cfg.RAGCorpusID, req.Discipline, req.RuleEdition)
+	cacheKey, cacheable := h.cacheKey(ctx, req, answercache.Scope{
+		Corpus:        corpus,
+		PromptVersion: promptVersion,
+		PromptVariant: promptVariant,
+		TopK:          topK,
+		MinConfidence: minConf,
+		RetrievalMode: retrievalMode,
+	}, logFields)
+	if cacheable {
+		if resp, clarification, cached, ok := h.cachedAnswer(ctx, cacheKey, req, usage, logFields); ok {
+			return resp, clarification, cached, nil
+		}
+	}
+	// finish stamps the prompts the result was generated with, which
+	// feedback on it must send back, and caches the result.
+	finish := func(resp *domain.AskResponse, clarification *domain.ClarificationResponse) (*domain.AskResponse, *domain.ClarificationResponse, cacheInfo, error) {
+		if resp != nil {
+			resp.Meta.PromptVersion, resp.Meta.PromptVariant = promptVersion, promptVariant
+		} else {
+			clarification.Meta.PromptVersion, clarification.Meta.PromptVariant = promptVersion, promptVariant
+		}
+		if !cacheable {
+			return resp, clarification, cacheInfo{}, nil
+		}
+		return resp, clarification, h.storeAnswer(ctx, cacheKey, resp, clarification, logFields), nil
+	}
+
+	// Conversation history for follow-up questions. Follow-ups are neither
+	// clarified nor decomposed: the rewrite resolves them against history.
+	convID, history, convWarnings := h.loadConversation(ctx, req, logFields)
+	warnings = append(warnings, convWarnings...)
+	followUp := len(history) > 0
+	if convID != "" {
+		logFields = append(logFields, "conversation_id", convID, "history_turns", len(history))
+	}
 
-	// Step 2: RAG retrieval.
+	if trace != nil {
+		trace.HistoryTurns = len(history)
+	}
+
+	// Step 1: Optional clarification of questions that depend on unspecified context.
+	if req.ClarificationAllowed() && !followUp {
+		if cl := h.clarify(ctx, req, usage, trace, logFields); cl != nil {
+			resp := &domain.ClarificationResponse{
+				Clarification: *cl,
+				Question:      req.Question,
+				Language:      req.Language,
+				// A new conversation starts with the answer, not the clarification.
+				ConversationID: req.ConversationID,
+				Meta: domain.Meta{
+					RAGCorpus: corpus,
+					TopK:      topK,
+					Warnings:  warnings,
+				},
+			}
+			if h.cfg.ExposeUsage {
+				resp.Meta.Usage = usage
+			}
+			resp.Debug = finishTrace(trace, nil, minConf, usage, totalStart)
+			return finish(nil, resp)
+		}
+	}
+
+	// Optional decomposition of compound questions.
+	questions := []string{req.Question}
+	if !followUp && req.EffectiveDecompose(h.cfg.Decompose) {
+		if subs := h.decompose(ctx, req, usage, trace, logFields); len(subs) > 1 {
+			questions = subs
+		}
+	}
+	decomposed := len(questions) > 1
+
+	// Step 2-3: Query rewrite (question language → EN) and RAG retrieval, per part.
 	retrieveStart := time.Now()
-	contexts, err := h.retriever.RetrieveContexts(ctx, rewritten.QueryEN, corpusID, topK)
+	parts, err := h.runParts(ctx, req, questions, history, retrievalMode, topK, logFields)
 	retrieveLatency := time.Since(retrieveStart)
 	if err != nil {
-		slog.ErrorContext(ctx, "retrieval failed", append(logFields, "error", err)...)
-		return respondAppError(c, domain.NewVertexError("context retrieval failed", err))
+		return nil, nil, cacheInfo{}, err
+	}
+	if trace != nil {
+		trace.RetrieveMS = retrieveLatency.Milliseconds()
+	}
+	for _, p := range parts {
+		h.addUsage(usage, p.rewritten.Usage)
+		for _, w := range p.warnings {
+			if !slices.Contains(warnings, w) {
+				warnings = append(warnings, w)
+			}
+		}
+	}
+	rewriteModel := parts[0].rewritten.Model
+	standalone := ""
+	if followUp && parts[0].rewritten.StandaloneQuestion != req.Question {
+		standalone = parts[0].rewritten.StandaloneQuestion
 	}
 
-	// Step 3: Score gating.
+	// Step 4: Score gating. A decomposed question keeps the parts that pass
+	// and answers from those; it is "not found" only if none pass.
 	maxScore := 0.0
-	for _, ctx := range contexts {
-		if ctx.Score > maxScore {
-			maxScore = ctx.Score
+	var passed []*part
+	for _, p := range parts {
+		maxScore = max(maxScore, p.maxScore)
+		if p.maxScore >= minConf {
+			passed = append(passed, p)
+		} else if decomposed {
+			warnings = append(warnings, "sub_question_not_found: "+p.question)
 		}
 	}
 
-	slog.InfoContext(ctx, "retrieval done",
-		append(logFields,
-			"max_score", maxScore,
-			"num_contexts", len(contexts),
-			"retrieve_ms", retrieveLatency.Milliseconds(),
-		)...,
-	)
-
-	corpus := rag.CorpusName(corpusID, req.Discipline, req.RuleEdition)
-
-	if maxScore < minConf {
+	if len(passed) == 0 {
 		slog.InfoContext(ctx, "below confidence threshold",
-			append(logFields, "max_score", maxScore, "threshold", minConf)...,
+			append(logFields,
+				"max_score", maxScore,
+				"threshold", minConf,
+				"total_tokens", usage.PromptTokens+usage.CandidateTokens+usage.ThoughtsTokens,
+				"estimated_cost_usd", usage.EstimatedCostUSD,
+			)...,
 		)
-		resp := domain.NotFoundResponse(corpus, topK)
-		return c.JSON(http.StatusOK, resp)
+		resp := domain.NotFoundResponse(req.Language, corpus, topK)
+		resp.ConversationID = convID
+		if req.ContextsRequested() {
+			resp.Contexts = contextExcerpts(parts, minConf, decomposed)
+		}
+		h.saveTurn(ctx, convID, req, standalone, resp.Answer, nil, logFields)
+		resp.Meta.Warnings = warnings
+		resp.Meta.RewriteModel = rewriteModel
+		if decomposed {
+			resp.Meta.SubQuestions = questions
+		}
+		if h.cfg.ExposeUsage {
+			resp.Meta.Usage = usage
+		}
+		resp.Debug = finishTrace(trace, parts, minConf, usage, totalStart)
+		return finish(resp, nil)
 	}
 
-	// Step 4: Answer generation.
+	// Step 5: Answer generation. A follow-up is answered as its standalone form.
+	in := llm.AnswerInput{
+		Question:  req.Question,
+		Language:  req.Language,
+		SourceURL: h.cfg.SourceURL,
+	}
+	if standalone != "" {
+		in.Question = standalone
+	}
+	if decomposed {
+		// Parts keep their position so citation indexes match Meta.SubQuestions.
+		for _, p := range parts {
+			ap := llm.AnswerPart{Question: p.question}
+			if p.maxScore >= minConf {
+				ap.Contexts = p.contexts
+			}
+			in.Parts = append(in.Parts, ap)
+		}
+	} else {
+		in.Contexts = parts[0].contexts
+	}
 	genStart := time.Now()
-	answer, err := h.llm.GenerateAnswer(ctx, req.QuestionJA, contexts, h.cfg.SourceURL)
+	answer, err := h.llm.GenerateAnswer(ctx, in)
 	genLatency := time.Since(genStart)
 	if err != nil {
 		slog.ErrorContext(ctx, "generation failed", append(logFields, "error", err)...)
-		return respondAppError(c, domain.NewVertexError("answer generation failed", err))
+		return nil, nil, cacheInfo{}, llmError("answer generation failed", err)
 	}
 
 	totalLatency := time.Since(totalStart)
+	h.addUsage(usage, answer.Usage)
+	trace.AddStage(domain.StageTrace{Stage: "answer", Model: answer.Model, Usage: answer.Usage, Prompt: answer.Prompt, DurationMS: genLatency.Milliseconds()})
 
 	slog.InfoContext(ctx, "answer generated",
 		append(logFields,
 			"confidence", answer.Confidence,
+			"answer_model", answer.Model,
+			"answer_usage", answer.Usage,
+			"total_tokens", usage.PromptTokens+usage.CandidateTokens+usage.ThoughtsTokens,
+			"estimated_cost_usd", usage.EstimatedCostUSD,
 			"num_citations", len(answer.Citations),
-			"rewrite_ms", rewriteLatency.Milliseconds(),
+			"warnings", answer.Warnings,
+			"sub_questions", len(questions),
 			"retrieve_ms", retrieveLatency.Milliseconds(),
 			"generate_ms", genLatency.Milliseconds(),
 			"total_ms", totalLatency.Milliseconds(),
@@ -143,29 +419,138 @@ func (h *Handler) Ask(c echo.Context) error {
 	// Enforce citation constraints at handler level (defense in depth).
 	citations := answer.Citations
 	for i := range citations {
-		citations[i].QuoteEN = enforceWordLimit(citations[i].QuoteEN, 25)
+		citations[i].QuoteEN = enforceWordLimit(citations[i].QuoteEN, maxQuoteWords)
 		if citations[i].SourceURL == "" {
 			citations[i].SourceURL = h.cfg.SourceURL
 		}
+		if !decomposed || citations[i].SubQuestion < 0 || citations[i].SubQuestion > len(questions) {
+			citations[i].SubQuestion = 0
+		}
 	}
 	if citations == nil {
 		citations = []domain.Citation{}
 	}
 
-	resp := &domain.AskResponse{
-		AnswerJA:   answer.AnswerJA,
-		Confidence: answer.Confidence,
-		Citations:  citations,
-		Meta: domain.Meta{
-			RAGCorpus: corpus,
-			TopK:      topK,
-			Warnings:  []string{},
-		},
+	h.saveTurn(ctx, convID, req, standalone, answer.Answer, citations, logFields)
+
+	resp := domain.NewAskResponse(req.Language, answer.Answer)
+	resp.Confidence = answer.Confidence
+	resp.Citations = citations
+	resp.ConversationID = convID
+	if req.ContextsRequested() {
+		resp.Contexts = contextExcerpts(parts, minConf, decomposed)
+	}
+	resp.Meta = domain.Meta{
+		RAGCorpus:    corpus,
+		TopK:         topK,
+		Warnings:     append(warnings, answer.Warnings...),
+		RewriteModel: rewriteModel,
+		AnswerModel:  answer.Model,
+	}
+	if decomposed {
+		resp.Meta.SubQuestions = questions
+	}
+	if h.cfg.ExposeUsage {
+		resp.Meta.Usage = usage
+	}
+	resp.Debug = finishTrace(trace, parts, minConf, usage, totalStart)
+
+	return finish(resp, nil)
+}
+
+// finishTrace fills in the parts, gate decision and totals of a debug trace.
+// It returns nil when debugging is off.
+func finishTrace(trace *domain.Trace, parts []*part, minConf float64, usage *domain.UsageSummary, start time.Time) *domain.Trace {
+	if trace == nil {
+		return nil
+	}
+	trace.Parts = []domain.PartTrace{}
+	if len(parts) > 0 {
+		trace.Gate = &domain.GateTrace{Threshold: minConf}
+	}
+	for _, p := range parts {
+		pt := p.trace
+		pt.MaxScore = p.maxScore
+		pt.PassedGate = p.maxScore >= minConf
+		trace.Parts = append(trace.Parts, pt)
+		trace.Gate.MaxScore = max(trace.Gate.MaxScore, p.maxScore)
+		trace.Gate.Passed = trace.Gate.Passed || pt.PassedGate
+	}
+	if trace.Stages == nil {
+		trace.Stages = []domain.StageTrace{}
+	}
+	trace.Usage = *usage
+	trace.TotalMS = time.Since(start).Milliseconds()
+	return trace
+}
+
+// ReloadPrompts re-reads the prompt file and atomically swaps it in if valid.
+func (h *Handler) ReloadPrompts(c echo.Context) error {
+	ctx := c.Request().Context()
+	changed, err := h.cfg.Prompts.Reload()
+	if err != nil {
+		slog.ErrorContext(ctx, "prompt reload failed; keeping current prompts",
+			"request_id", logging.RequestID(ctx), "error", err)
+		return c.JSON(http.StatusUnprocessableEntity, domain.ErrorResponse{
+			Error:   "prompt reload failed",
+			Code:    string(domain.ErrCatValidation),
+			Details: err.Error(),
+		})
+	}
+
+	version := h.cfg.Prompts.Current().Version
+	slog.InfoContext(ctx, "prompts reloaded",
+		"request_id", logging.RequestID(ctx), "trigger", "admin", "version", version, "changed", changed)
+	return c.JSON(http.StatusOK, map[string]any{"version": version, "changed": changed})
+}
+
+// llmError maps an LLM failure to an AppError. Responses that were blocked or
+// truncated get their own categories; everything else is an upstream error.
+func llmError(msg string, err error) *domain.AppError {
+	switch {
+	case errors.Is(err, llm.ErrSafetyBlocked):
+		return domain.NewSafetyBlockedError(err)
+	case errors.Is(err, llm.ErrRecitation):
+		return domain.NewRecitationError(err)
+	case errors.Is(err, llm.ErrTruncated):
+		return domain.NewTruncatedError(err)
 	}
+	return domain.NewVertexError(msg, err)
+}
 
-	return c.JSON(http.StatusOK, resp)
+// addUsage accumulates a single call's usage and its estimated cost.
+func (h *Handler) addUsage(sum *domain.UsageSummary, u *domain.Usage) {
+	sum.Add(u)
+	sum.EstimatedCostUSD += h.cfg.Prices.Cost(u)
+}
+
+// contextExcerpts lists the retrieved contexts of every part, clipped to the
+// citation quote limit.
+func contextExcerpts(parts []*part, minConf float64, decomposed bool) []domain.ContextExcerpt {
+	out := []domain.ContextExcerpt{}
+	for i, p := range parts {
+		for _, c := range p.contexts {
+			e := domain.ContextExcerpt{
+				RuleID:       c.RuleID,
+				SectionTitle: c.SectionTitle,
+				SourceURI:    c.SourceURI,
+				Score:        c.Score,
+				Excerpt:      enforceWordLimit(c.Text, maxQuoteWords),
+				PassedGate:   p.maxScore >= minConf,
+			}
+			if decomposed {
+				e.SubQuestion = i + 1
+			}
+			out = append(out, e)
+		}
+	}
+	return out
 }
 
+// maxQuoteWords bounds rule text returned to clients (citation quotes and
+// context excerpts).
+const maxQuoteWords = 25
+
 // enforceWordLimit truncates text to maxWords and appends "..." if truncated.
 func enforceWordLimit(text string, maxWords int) string {
 	words := strings.Fields(text)
@@ -176,15 +561,23 @@ func enforceWordLimit(text string, maxWords int) string {
 }
 
 func respondAppError(c echo.Context, err error) error {
+	status, resp := appErrorResponse(err)
+	return c.JSON(status, resp)
+}
+
+// appErrorResponse maps an error to its HTTP status and body. Errors that are
+// not AppErrors are reported as internal errors without details.
+func appErrorResponse(err error) (int, domain.ErrorResponse) {
 	var appErr *domain.AppError
 	if errors.As(err, &appErr) {
-		return c.JSON(appErr.StatusCode, domain.ErrorResponse{
-			Error: appErr.Message,
-			Code:  string(appErr.Category),
-		})
+		return appErr.StatusCode, domain.ErrorResponse{
+			Error:   appErr.Message,
+			Code:    string(appErr.Category),
+			Details: appErr.Details,
+		}
 	}
-	return c.JSON(http.StatusInternalServerError, domain.ErrorResponse{
+	return http.StatusInternalServerError, domain.ErrorResponse{
 		Error: "internal server error",
 		Code:  string(domain.ErrCatUnknown),
-	})
+	}
 }
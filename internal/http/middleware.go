@@ -1,8 +1,14 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -11,6 +17,7 @@ import (
 
 	"github.com/shunpei/rulegate/internal/domain"
 	"github.com/shunpei/rulegate/internal/logging"
+	"github.com/shunpei/rulegate/internal/openapi"
 	"golang.org/x/time/rate"
 )
 
@@ -51,6 +58,53 @@ func LoggingMiddleware() echo.MiddlewareFunc {
 	}
 }
 
+// DefaultMaxBodyBytes bounds request bodies.
+const DefaultMaxBodyBytes = 1 << 20
+
+// ValidateBodyMiddleware rejects request bodies that do not match the OpenAPI
+// schema of T (unknown fields, wrong types) before the handler binds them.
+// Bodies larger than maxBytes (<= 0 means DefaultMaxBodyBytes) are rejected
+// with 413 without being read further.
+func ValidateBodyMiddleware[T any](maxBytes int64) echo.MiddlewareFunc {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodyBytes
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			body, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxBytes))
+			if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+				return respondAppError(c, domain.NewBodyTooLargeError(maxBytes))
+			}
+			if err != nil {
+				return respondAppError(c, domain.NewValidationError("failed to read request body"))
+			}
+			if err := openapi.Validate[T](body); err != nil {
+				return respondAppError(c, domain.NewSchemaError(err.Error()))
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+			return next(c)
+		}
+	}
+}
+
+// AdminAuthMiddleware requires "Authorization: Bearer <token>".
+func AdminAuthMiddleware(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !validBearer(c.Request().Header.Get("Authorization"), token) {
+				return respondAppError(c, domain.NewUnauthorizedError())
+			}
+			return next(c)
+		}
+	}
+}
+
+// validBearer reports whether header carries the expected bearer token.
+func validBearer(header, token string) bool {
+	got, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
 // IPRateLimiter implements per-IP token bucket rate limiting.
 type IPRateLimiter struct {
 	mu       sync.Mutex
@@ -78,22 +132,78 @@ func (l *IPRateLimiter) getLimiter(ip string) *rate.Limiter {
 	return lim
 }
 
+// rateLimiterKey is the echo context key under which Middleware stores the
+// client's limiter, so handlers can charge requests that cost more than one.
+const rateLimiterKey = "rate_limiter"
+
 // Middleware returns an Echo middleware that enforces rate limiting.
 func (l *IPRateLimiter) Middleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			ip := clientIP(c)
-			if !l.getLimiter(ip).Allow() {
+			lim := l.getLimiter(ip)
+			if !lim.Allow() {
 				return c.JSON(429, domain.ErrorResponse{
 					Error: "rate limit exceeded",
 					Code:  string(domain.ErrCatRateLimit),
 				})
 			}
+			c.Set(rateLimiterKey, lim)
 			return next(c)
 		}
 	}
 }
 
+// MaxRateLimitWait bounds how long a request waits for the rate limit tokens
+// it reserved, unless its context has an earlier deadline.
+const MaxRateLimitWait = 10 * time.Second
+
+// reserveRateLimit reserves n more tokens from the client's bucket, on top of
+// the one Middleware took, one token at a time, and returns when each becomes
+// available. A request may therefore cost more than the burst; the work paid
+// for by a token waits until that token's time. If the last token would come
+// later than MaxRateLimitWait or the context deadline, nothing is reserved
+// and a rate limit error is returned. Without the middleware every time is
+// zero.
+func reserveRateLimit(c echo.Context, n int) ([]time.Time, error) {
+	times := make([]time.Time, max(n, 0))
+	lim, ok := c.Get(rateLimiterKey).(*rate.Limiter)
+	if !ok || n <= 0 {
+		return times, nil
+	}
+	now := time.Now()
+	wait := MaxRateLimitWait
+	if deadline, ok := c.Request().Context().Deadline(); ok {
+		wait = min(wait, deadline.Sub(now))
+	}
+	if missing := float64(n) - lim.TokensAt(now); missing > 0 &&
+		(lim.Limit() <= 0 || missing/float64(lim.Limit()) > wait.Seconds()) {
+		err := domain.NewRateLimitError()
+		err.Details = fmt.Sprintf("the request costs %d rate limit tokens, more than can be granted within %s", n+1, wait.Round(time.Second))
+		return nil, err
+	}
+	for i := range times {
+		times[i] = now.Add(lim.ReserveN(now, 1).DelayFrom(now))
+	}
+	return times, nil
+}
+
+// waitUntil blocks until t or until ctx is done, whichever comes first.
+func waitUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func clientIP(c echo.Context) string {
 	// X-Forwarded-For from Cloud Run / load balancers.
 	if xff := c.Request().Header.Get("X-Forwarded-For"); xff != "" {
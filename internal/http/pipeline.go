@@ -0,0 +1,230 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/llm"
+	"github.com/shunpei/rulegate/internal/rag"
+)
+
+// maxSubQuestions caps the parts a decomposed question is split into.
+const maxSubQuestions = 4
+
+// part is one (sub-)question with its rewrite and retrieved contexts.
+type part struct {
+	question  string
+	rewritten *domain.RewriteResult
+	contexts  []domain.RetrievedContext
+	maxScore  float64
+	warnings  []string
+	// trace is recorded for every part and returned only to debug requests.
+	trace domain.PartTrace
+}
+
+// clarify checks whether the question needs a clarifying question first.
+// Failures are logged and yield nil, so the question is answered as asked.
+func (h *Handler) clarify(ctx context.Context, req *domain.AskRequest, usage *domain.UsageSummary, trace *domain.Trace, logFields []any) *domain.Clarification {
+	cl, ok := h.llm.(llm.Clarifier)
+	if !ok {
+		return nil
+	}
+	start := time.Now()
+	res, err := cl.ClarifyQuestion(ctx, llm.ClarifyInput{Question: req.Question, Language: req.Language, Context: req.Context})
+	if err != nil {
+		trace.AddStage(domain.StageTrace{Stage: "clarify", DurationMS: time.Since(start).Milliseconds(), Error: err.Error()})
+		slog.WarnContext(ctx, "clarification check failed; answering as asked", append(logFields, "error", err)...)
+		return nil
+	}
+	h.addUsage(usage, res.Usage)
+	trace.AddStage(domain.StageTrace{Stage: "clarify", Model: res.Model, Usage: res.Usage, Prompt: res.Prompt, DurationMS: time.Since(start).Milliseconds()})
+
+	clarification := res.Clarification()
+	slog.InfoContext(ctx, "clarification checked",
+		append(logFields,
+			"needs_clarification", clarification != nil,
+			"field", res.Field,
+			"clarify_model", res.Model,
+			"clarify_ms", time.Since(start).Milliseconds(),
+		)...,
+	)
+	return clarification
+}
+
+// decompose splits a compound question into sub-questions. Failures are
+// logged and yield nil, so the question is answered as a whole.
+func (h *Handler) decompose(ctx context.Context, req *domain.AskRequest, usage *domain.UsageSummary, trace *domain.Trace, logFields []any) []string {
+	d, ok := h.llm.(llm.Decomposer)
+	if !ok {
+		return nil
+	}
+	start := time.Now()
+	res, err := d.DecomposeQuestion(ctx, llm.DecomposeInput{Question: req.Question, Language: req.Language})
+	if err != nil {
+		trace.AddStage(domain.StageTrace{Stage: "decompose", DurationMS: time.Since(start).Milliseconds(), Error: err.Error()})
+		slog.WarnContext(ctx, "decomposition failed; answering as a single question", append(logFields, "error", err)...)
+		return nil
+	}
+	h.addUsage(usage, res.Usage)
+	trace.AddStage(domain.StageTrace{Stage: "decompose", Model: res.Model, Usage: res.Usage, Prompt: res.Prompt, DurationMS: time.Since(start).Milliseconds()})
+
+	subs := res.SubQuestions
+	if len(subs) > maxSubQuestions {
+		subs = subs[:maxSubQuestions]
+	}
+	slog.InfoContext(ctx, "question decomposed",
+		append(logFields,
+			"sub_questions", subs,
+			"decompose_model", res.Model,
+			"decompose_ms", time.Since(start).Milliseconds(),
+		)...,
+	)
+	return subs
+}
+
+// runParts rewrites and retrieves every question concurrently. The first
+// failure (in question order) is returned as an AppError.
+func (h *Handler) runParts(ctx context.Context, req *domain.AskRequest, questions []string, history []domain.Turn, mode domain.RetrievalMode, topK int, logFields []any) ([]*part, error) {
+	parts := make([]*part, len(questions))
+	errs := make([]error, len(questions))
+	var wg sync.WaitGroup
+	for i, q := range questions {
+		fields := logFields
+		if len(questions) > 1 {
+			fields = append(append([]any{}, logFields...), "sub_question", i+1)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parts[i], errs[i] = h.rewriteAndRetrieve(ctx, req, q, history, mode, topK, fields)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return parts, nil
+}
+
+// rewriteAndRetrieve rewrites one question into retrieval queries and
+// retrieves its contexts. history resolves a follow-up question.
+func (h *Handler) rewriteAndRetrieve(ctx context.Context, req *domain.AskRequest, question string, history []domain.Turn, mode domain.RetrievalMode, topK int, logFields []any) (*part, error) {
+	rewriteStart := time.Now()
+	rewritten, err := h.llm.RewriteQuery(ctx, llm.RewriteInput{
+		Question: question,
+		Language: req.Language,
+		Context:  req.Context,
+		HyDE:     mode.UsesHyDE(),
+		History:  history,
+	})
+	rewriteLatency := time.Since(rewriteStart)
+	if err != nil {
+		slog.ErrorContext(ctx, "rewrite failed", append(logFields, "error", err)...)
+		return nil, llmError("query rewrite failed", err)
+	}
+
+	slog.InfoContext(ctx, "query rewritten",
+		append(logFields,
+			"q_en", rewritten.QueryEN,
+			"hypothetical_passage_en", rewritten.HypotheticalEN,
+			"standalone_question", rewritten.StandaloneQuestion,
+			"rewrite_model", rewritten.Model,
+			"rewrite_usage", rewritten.Usage,
+			"rewrite_ms", rewriteLatency.Milliseconds(),
+		)...,
+	)
+
+	p := &part{question: question, rewritten: rewritten}
+	p.trace = domain.PartTrace{
+		Question: question,
+		Rewrite: domain.RewriteTrace{
+			QueryEN:            rewritten.QueryEN,
+			KeywordsEN:         rewritten.KeywordsEN,
+			QueryJA:            rewritten.QueryJA,
+			HypotheticalEN:     rewritten.HypotheticalEN,
+			StandaloneQuestion: rewritten.StandaloneQuestion,
+			Model:              rewritten.Model,
+			Usage:              rewritten.Usage,
+			Prompt:             rewritten.Prompt,
+			DurationMS:         rewriteLatency.Milliseconds(),
+		},
+	}
+	// Follow-ups are rewritten without a hypothetical passage; they retrieve
+	// with q_en and are not warned about it.
+	if mode.UsesHyDE() && rewritten.HypotheticalEN == "" && len(history) == 0 {
+		p.warnings = append(p.warnings, "hyde_unavailable: no hypothetical passage was generated; retrieved with q_en")
+	}
+
+	retrieveStart := time.Now()
+	queries := retrievalQueries(mode, rewritten)
+	var raw [][]domain.RetrievedContext
+	p.contexts, raw, err = h.retrieve(ctx, queries, h.cfg.RAGCorpusID, topK)
+	retrieveLatency := time.Since(retrieveStart)
+	if err != nil {
+		slog.ErrorContext(ctx, "retrieval failed", append(logFields, "error", err)...)
+		return nil, domain.NewVertexError("context retrieval failed", err)
+	}
+	for i, q := range queries {
+		p.trace.Retrievals = append(p.trace.Retrievals, domain.RetrievalTrace{Query: q, Results: domain.NewScoredContexts(raw[i])})
+	}
+	p.trace.RetrieveMS = retrieveLatency.Milliseconds()
+	p.trace.Contexts = domain.NewScoredContexts(p.contexts)
+
+	for _, c := range p.contexts {
+		p.maxScore = max(p.maxScore, c.Score)
+	}
+
+	slog.InfoContext(ctx, "retrieval done",
+		append(logFields,
+			"max_score", p.maxScore,
+			"num_contexts", len(p.contexts),
+			"retrieve_ms", retrieveLatency.Milliseconds(),
+		)...,
+	)
+	return p, nil
+}
+
+// retrievalQueries returns the retrieval queries for mode. HyDE modes fall
+// back to q_en when the rewrite produced no hypothetical passage.
+func retrievalQueries(mode domain.RetrievalMode, rw *domain.RewriteResult) []string {
+	if !mode.UsesHyDE() || rw.HypotheticalEN == "" {
+		return []string{rw.QueryEN}
+	}
+	if mode == domain.RetrievalHyDEFused {
+		return []string{rw.QueryEN, rw.HypotheticalEN}
+	}
+	return []string{rw.HypotheticalEN}
+}
+
+// retrieve runs one retrieval per query concurrently, calibrates the scores
+// and merges the results. It also returns each query's results as retrieved.
+func (h *Handler) retrieve(ctx context.Context, queries []string, corpusID string, topK int) ([]domain.RetrievedContext, [][]domain.RetrievedContext, error) {
+	if len(queries) == 1 {
+		cs, err := h.retriever.RetrieveContexts(ctx, queries[0], corpusID, topK)
+		cs = h.cfg.ScoreMetric.CalibrateContexts(cs)
+		return cs, [][]domain.RetrievedContext{cs}, err
+	}
+
+	results := make([][]domain.RetrievedContext, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cs, err := h.retriever.RetrieveContexts(ctx, q, corpusID, topK)
+			results[i], errs[i] = h.cfg.ScoreMetric.CalibrateContexts(cs), err
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+	return rag.MergeContexts(topK, results...), results, nil
+}
@@ -0,0 +1,140 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+const (
+	// DefaultReadyCacheTTL is how long a readiness result is reused.
+	DefaultReadyCacheTTL = 10 * time.Second
+	// DefaultReadyTimeout bounds each dependency check.
+	DefaultReadyTimeout = 3 * time.Second
+)
+
+// readiness caches the last readiness result so frequent probes do not call
+// the backends every time.
+type readiness struct {
+	mu      sync.Mutex // held while checks run, so concurrent probes share one run
+	result  *domain.ReadinessResponse
+	checked time.Time
+}
+
+// Readyz reports whether the retriever and LLM backends are usable, with
+// per-dependency status. It returns 503 when a dependency is unavailable.
+// Error messages can name projects, corpora and credentials, so only callers
+// with the admin token see them; they are logged for everyone else.
+func (h *Handler) Readyz(c echo.Context) error {
+	resp := h.readiness(c.Request().Context(), false)
+	status := http.StatusOK
+	if resp.Status == domain.HealthUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	if !h.debugAllowed(c) {
+		resp = withoutErrors(resp)
+	}
+	return c.JSON(status, resp)
+}
+
+// withoutErrors returns a copy of resp without the error messages.
+func withoutErrors(resp *domain.ReadinessResponse) *domain.ReadinessResponse {
+	out := &domain.ReadinessResponse{Status: resp.Status, Checks: make(map[string]domain.DependencyStatus, len(resp.Checks))}
+	for name, st := range resp.Checks {
+		st.Error = ""
+		out.Checks[name] = st
+	}
+	return out
+}
+
+// WarmUp runs the readiness checks, one trivial call per backend, and
+// primes the /readyz cache. Call it before accepting traffic.
+func (h *Handler) WarmUp(ctx context.Context) *domain.ReadinessResponse {
+	return h.readiness(ctx, true)
+}
+
+// readiness returns the cached result, running the checks when it is older
+// than Config.ReadyCacheTTL or force is set.
+func (h *Handler) readiness(ctx context.Context, force bool) *domain.ReadinessResponse {
+	ttl := h.cfg.ReadyCacheTTL
+	if ttl <= 0 {
+		ttl = DefaultReadyCacheTTL
+	}
+	h.ready.mu.Lock()
+	defer h.ready.mu.Unlock()
+	if !force && h.ready.result != nil && time.Since(h.ready.checked) < ttl {
+		return h.ready.result
+	}
+	// The result is shared with later probes, so a probe that disconnects
+	// must not cancel the checks.
+	h.ready.result = h.checkReadiness(context.WithoutCancel(ctx))
+	h.ready.checked = time.Now()
+	return h.ready.result
+}
+
+// checkReadiness checks the backends concurrently, each bounded by
+// Config.ReadyTimeout, and reports the prompt reload state.
+func (h *Handler) checkReadiness(ctx context.Context) *domain.ReadinessResponse {
+	timeout := h.cfg.ReadyTimeout
+	if timeout <= 0 {
+		timeout = DefaultReadyTimeout
+	}
+	checks := map[string]func(context.Context) error{
+		"retriever": h.retriever.HealthCheck,
+		"llm":       h.llm.HealthCheck,
+	}
+
+	resp := &domain.ReadinessResponse{Status: domain.HealthOK, Checks: map[string]domain.DependencyStatus{}}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range checks {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			err := check(ctx)
+			st := domain.DependencyStatus{Status: domain.HealthOK, LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				slog.WarnContext(ctx, "readiness check failed", "dependency", name, "error", err)
+				st.Status, st.Error = domain.HealthUnavailable, err.Error()
+			}
+			mu.Lock()
+			resp.Checks[name] = st
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	if h.cfg.Prompts != nil {
+		st := domain.DependencyStatus{Status: domain.HealthOK, Version: h.cfg.Prompts.Current().Version}
+		if err := h.cfg.Prompts.ReloadError(); err != nil {
+			slog.WarnContext(ctx, "readiness check degraded", "dependency", "prompts", "error", err)
+			st.Status = domain.HealthDegraded
+			st.Error = fmt.Sprintf("last reload failed; serving the previous prompts: %v", err)
+		}
+		resp.Checks["prompts"] = st
+	}
+
+	for _, st := range resp.Checks {
+		resp.Status = worse(resp.Status, st.Status)
+	}
+	return resp
+}
+
+// worse returns the more severe of two statuses.
+func worse(a, b domain.HealthStatus) domain.HealthStatus {
+	rank := map[domain.HealthStatus]int{domain.HealthOK: 0, domain.HealthDegraded: 1, domain.HealthUnavailable: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
@@ -3,6 +3,8 @@ package http
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/shunpei/rulegate/internal/domain"
 )
 
 // NewRouter creates an Echo router with all routes and middleware.
@@ -17,14 +19,37 @@ func NewRouter(h *Handler, rateLimiter *IPRateLimiter, allowOrigin string) *echo
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{allowOrigin},
 		AllowMethods: []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders: []string{"Content-Type"},
+		AllowHeaders: []string{"Content-Type", "Authorization"},
 	}))
 	e.Use(LoggingMiddleware())
 	e.Use(rateLimiter.Middleware())
 
 	// Routes.
 	e.GET("/healthz", h.Healthz)
-	e.POST("/api/ask", h.Ask)
+	e.GET("/readyz", h.Readyz)
+	e.GET("/api/openapi.json", h.OpenAPI)
+
+	// /api/v1 is frozen; new response fields only appear under /api/v2. The
+	// unversioned routes predate versioning and keep serving v1.
+	validateAsk := ValidateBodyMiddleware[domain.AskRequest](h.cfg.MaxBodyBytes)
+	validateBatch := ValidateBodyMiddleware[domain.BatchAskRequest](h.cfg.MaxBodyBytes)
+	e.POST("/api/ask", h.AskV1, validateAsk)
+	e.POST("/api/ask/batch", h.AskBatchV1, validateBatch)
+	v1 := e.Group("/api/v1")
+	v1.POST("/ask", h.AskV1, validateAsk)
+	v1.POST("/ask/batch", h.AskBatchV1, validateBatch)
+	v2 := e.Group("/api/v2")
+	v2.POST("/ask", h.Ask, validateAsk)
+	v2.POST("/ask/batch", h.AskBatch, validateBatch)
+
+	if h.cfg.Feedback != nil {
+		e.POST("/api/feedback", h.Feedback, ValidateBodyMiddleware[domain.FeedbackRequest](h.cfg.MaxBodyBytes))
+	}
+
+	if h.cfg.AdminToken != "" && h.cfg.Prompts != nil {
+		admin := e.Group("/admin", AdminAuthMiddleware(h.cfg.AdminToken))
+		admin.POST("/prompts/reload", h.ReloadPrompts)
+	}
 
 	return e
 }
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// apiVersion selects the response contract a route serves. Both versions run
+// the same handlers; only the final rendering differs.
+type apiVersion int
+
+const (
+	// apiV1 is frozen: responses are converted to the domain V1 types.
+	apiV1 apiVersion = 1
+	// apiV2 serves the domain types as they evolve.
+	apiV2 apiVersion = 2
+)
+
+// AskV1 serves /api/v1/ask and the unversioned /api/ask.
+func (h *Handler) AskV1(c echo.Context) error {
+	return h.ask(c, apiV1)
+}
+
+// AskBatchV1 serves /api/v1/ask/batch and the unversioned /api/ask/batch.
+func (h *Handler) AskBatchV1(c echo.Context) error {
+	return h.askBatch(c, apiV1)
+}
+
+func (v apiVersion) askResponse(r *domain.AskResponse) any {
+	if v == apiV1 {
+		return r.V1()
+	}
+	return r
+}
+
+func (v apiVersion) clarificationResponse(r *domain.ClarificationResponse) any {
+	if v == apiV1 {
+		return r.V1()
+	}
+	return r
+}
+
+func (v apiVersion) batchResponse(r *domain.BatchAskResponse) any {
+	if v == apiV1 {
+		return r.V1()
+	}
+	return r
+}
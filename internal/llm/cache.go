@@ -0,0 +1,190 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// DefaultCacheTTL is the lifetime of a cached system instruction.
+	DefaultCacheTTL = time.Hour
+	// DefaultCacheMinTokens is the estimated size below which a system
+	// instruction is not cached; Vertex rejects caches below its minimum.
+	DefaultCacheMinTokens = 1024
+	// cacheFailureBackoff is how long a key that failed to cache is sent
+	// uncached before creation is attempted again.
+	cacheFailureBackoff = 10 * time.Minute
+	cacheCreateTimeout  = 30 * time.Second
+)
+
+// CacheConfig configures Vertex context caching of system instructions.
+type CacheConfig struct {
+	// TTL is the lifetime of each cached content; <= 0 means DefaultCacheTTL.
+	TTL time.Duration
+	// MinTokens skips caching for smaller system instructions; <= 0 means
+	// DefaultCacheMinTokens.
+	MinTokens int
+}
+
+// cacheCreator is the part of genai.Caches used by systemCache.
+type cacheCreator interface {
+	Create(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error)
+}
+
+// systemCache maps (model, system instruction) to a Vertex cached content.
+// Keys hash the instruction text, so a prompt reload or a different variant
+// gets its own cache; superseded caches are left to expire server-side.
+// Every failure degrades to an uncached call.
+type systemCache struct {
+	api       cacheCreator
+	ttl       time.Duration
+	minTokens int
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	name        string
+	expires     time.Time
+	creating    bool
+	failedUntil time.Time
+}
+
+func newSystemCache(api cacheCreator, cfg CacheConfig) *systemCache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultCacheTTL
+	}
+	if cfg.MinTokens <= 0 {
+		cfg.MinTokens = DefaultCacheMinTokens
+	}
+	return &systemCache{
+		api:       api,
+		ttl:       cfg.TTL,
+		minTokens: cfg.MinTokens,
+		now:       time.Now,
+		entries:   map[string]*cacheEntry{},
+	}
+}
+
+func cacheKey(model, system string) string {
+	sum := sha256.Sum256([]byte(system))
+	return model + "/" + hex.EncodeToString(sum[:8])
+}
+
+// refreshMargin is how long before expiry a cache is replaced, so that no
+// request starts with a cache that expires mid-call.
+func (s *systemCache) refreshMargin() time.Duration {
+	return min(s.ttl/10, time.Minute)
+}
+
+// lookup returns the cached content name for the system instruction, creating
+// it if needed. It returns "" when the call should go uncached: the
+// instruction is too small, creation failed recently, or another request is
+// creating the cache and no previous one is still valid.
+func (s *systemCache) lookup(ctx context.Context, model, system string) string {
+	if EstimateTokens(system) < s.minTokens {
+		return ""
+	}
+	key := cacheKey(model, system)
+	now := s.now()
+
+	s.mu.Lock()
+	e := s.entries[key]
+	switch {
+	case e == nil:
+		e = &cacheEntry{}
+		s.entries[key] = e
+	case e.creating:
+		// Keep using the previous cache while its replacement is created.
+		name := ""
+		if e.name != "" && now.Before(e.expires) {
+			name = e.name
+		}
+		s.mu.Unlock()
+		return name
+	case now.Before(e.failedUntil):
+		s.mu.Unlock()
+		return ""
+	case e.name != "" && now.Before(e.expires.Add(-s.refreshMargin())):
+		name := e.name
+		s.mu.Unlock()
+		return name
+	}
+	e.creating = true
+	s.pruneLocked(now)
+	s.mu.Unlock()
+
+	// Creation outlives a cancelled request so one impatient client doesn't
+	// put the key into failure backoff.
+	createCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheCreateTimeout)
+	cc, err := s.api.Create(createCtx, model, &genai.CreateCachedContentConfig{
+		TTL:               s.ttl,
+		DisplayName:       "rulegate-" + key,
+		SystemInstruction: &genai.Content{Parts: []*genai.Part{{Text: system}}},
+	})
+	cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.creating = false
+	if err != nil || cc == nil || cc.Name == "" {
+		e.name, e.failedUntil = "", now.Add(cacheFailureBackoff)
+		slog.WarnContext(ctx, "context cache creation failed; sending system instruction uncached",
+			"model", model, "cache_key", key, "error", err)
+		return ""
+	}
+	e.name, e.failedUntil = cc.Name, time.Time{}
+	e.expires = cc.ExpireTime
+	if e.expires.IsZero() {
+		e.expires = now.Add(s.ttl)
+	}
+	slog.InfoContext(ctx, "context cache created", "model", model, "cache_key", key, "cache", cc.Name, "expires", e.expires)
+	return e.name
+}
+
+// invalidate drops a cache the backend no longer accepts (e.g. deleted
+// out of band) so the next lookup creates a fresh one.
+func (s *systemCache) invalidate(model, system string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.entries[cacheKey(model, system)]; e != nil && !e.creating {
+		e.name = ""
+	}
+}
+
+// pruneLocked removes expired entries that are not being created and are not
+// in failure backoff.
+func (s *systemCache) pruneLocked(now time.Time) {
+	for k, e := range s.entries {
+		if !e.creating && now.After(e.expires) && now.After(e.failedUntil) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// isCacheRejected reports whether a generation call failed because its cached
+// content is gone or unusable, in which case the call is retried uncached.
+func isCacheRejected(err error) bool {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusNotFound, http.StatusForbidden:
+		return true
+	case http.StatusBadRequest:
+		return strings.Contains(strings.ToLower(apiErr.Message), "cache")
+	}
+	return false
+}
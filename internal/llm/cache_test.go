@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+type fakeCacheAPI struct {
+	calls []string
+	err   error
+}
+
+func (f *fakeCacheAPI) Create(_ context.Context, model string, cfg *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+	f.calls = append(f.calls, cfg.SystemInstruction.Parts[0].Text)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &genai.CachedContent{Name: fmt.Sprintf("cachedContents/%d", len(f.calls)), Model: model}, nil
+}
+
+func newTestCache(api cacheCreator) (*systemCache, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newSystemCache(api, CacheConfig{TTL: time.Hour, MinTokens: 10})
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+var longSystem = strings.Repeat("You answer canoe rule questions. ", 20)
+
+func TestSystemCache_ReusesUntilNearExpiry(t *testing.T) {
+	api := &fakeCacheAPI{}
+	c, now := newTestCache(api)
+	ctx := context.Background()
+
+	first := c.lookup(ctx, "m", longSystem)
+	if first == "" || c.lookup(ctx, "m", longSystem) != first {
+		t.Fatalf("expected the cache to be reused, got %q", first)
+	}
+	if len(api.calls) != 1 {
+		t.Fatalf("creates: got %d, want 1", len(api.calls))
+	}
+
+	*now = now.Add(time.Hour - 30*time.Second)
+	if got := c.lookup(ctx, "m", longSystem); got == first {
+		t.Errorf("expected a refresh within the margin before expiry")
+	}
+	if len(api.calls) != 2 {
+		t.Errorf("creates: got %d, want 2", len(api.calls))
+	}
+}
+
+func TestSystemCache_KeyedByModelAndText(t *testing.T) {
+	api := &fakeCacheAPI{}
+	c, _ := newTestCache(api)
+	ctx := context.Background()
+
+	a := c.lookup(ctx, "m", longSystem)
+	b := c.lookup(ctx, "m", longSystem+" v2")
+	d := c.lookup(ctx, "other", longSystem)
+	if a == b || a == d || b == d {
+		t.Errorf("expected distinct caches, got %q %q %q", a, b, d)
+	}
+}
+
+func TestSystemCache_SkipsSmallInstructions(t *testing.T) {
+	api := &fakeCacheAPI{}
+	c, _ := newTestCache(api)
+	if got := c.lookup(context.Background(), "m", "short"); got != "" {
+		t.Errorf("got %q, want uncached", got)
+	}
+	if len(api.calls) != 0 {
+		t.Errorf("creates: got %d, want 0", len(api.calls))
+	}
+}
+
+func TestSystemCache_BacksOffAfterFailure(t *testing.T) {
+	api := &fakeCacheAPI{err: errors.New("below minimum token count")}
+	c, now := newTestCache(api)
+	ctx := context.Background()
+
+	if got := c.lookup(ctx, "m", longSystem); got != "" {
+		t.Fatalf("got %q, want uncached", got)
+	}
+	api.err = nil
+	if got := c.lookup(ctx, "m", longSystem); got != "" {
+		t.Errorf("got %q during backoff, want uncached", got)
+	}
+	if len(api.calls) != 1 {
+		t.Errorf("creates during backoff: got %d, want 1", len(api.calls))
+	}
+
+	*now = now.Add(cacheFailureBackoff + time.Second)
+	if got := c.lookup(ctx, "m", longSystem); got == "" {
+		t.Errorf("expected a cache after the backoff")
+	}
+}
+
+func TestSystemCache_Invalidate(t *testing.T) {
+	api := &fakeCacheAPI{}
+	c, _ := newTestCache(api)
+	ctx := context.Background()
+
+	first := c.lookup(ctx, "m", longSystem)
+	c.invalidate("m", longSystem)
+	if got := c.lookup(ctx, "m", longSystem); got == first || got == "" {
+		t.Errorf("got %q, want a new cache after invalidate", got)
+	}
+}
+
+func TestIsCacheRejected(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{genai.APIError{Code: 404, Message: "CachedContent not found"}, true},
+		{fmt.Errorf("wrapped: %w", genai.APIError{Code: 403}), true},
+		{genai.APIError{Code: 400, Message: "Cached content is expired"}, true},
+		{genai.APIError{Code: 400, Message: "invalid temperature"}, false},
+		{genai.APIError{Code: 429}, false},
+		{errors.New("network"), false},
+	}
+	for _, tt := range tests {
+		if got := isCacheRejected(tt.err); got != tt.want {
+			t.Errorf("isCacheRejected(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -3,30 +3,102 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 
 	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/logging"
 	"google.golang.org/genai"
 )
 
 // LLM abstracts generative AI operations for testability.
 type LLM interface {
-	RewriteQuery(ctx context.Context, questionJA string, queryCtx *domain.QueryContext) (*domain.RewriteResult, error)
-	GenerateAnswer(ctx context.Context, questionJA string, contexts []domain.RetrievedContext, sourceURL string) (*domain.AnswerResult, error)
+	RewriteQuery(ctx context.Context, in RewriteInput) (*domain.RewriteResult, error)
+	GenerateAnswer(ctx context.Context, in AnswerInput) (*domain.AnswerResult, error)
+	// HealthCheck makes a cheap call that fails when the backend is
+	// unreachable, the credentials do not work or a model is unavailable.
+	HealthCheck(ctx context.Context) error
 	Close() error
 }
 
+// RewriteInput is the input of query rewriting.
+type RewriteInput struct {
+	Question string
+	Language domain.Language
+	Context  *domain.QueryContext
+	// HyDE also asks for a hypothetical rule passage (RewriteResult.HypotheticalEN).
+	// It is ignored when the query_rewrite_hyde_user section is not defined.
+	HyDE bool
+	// History holds the earlier turns of a conversation, oldest first. When
+	// set, the query_rewrite_followup_user section is used (if defined) and
+	// HyDE is ignored.
+	History []domain.Turn
+}
+
+// AnswerInput is the input of answer generation. Language is the language
+// of both the question and the answer.
+type AnswerInput struct {
+	Question  string
+	Language  domain.Language
+	Contexts  []domain.RetrievedContext
+	SourceURL string
+	// Parts, when set, replaces Contexts for a decomposed question: the answer
+	// is synthesised from each sub-question's own contexts.
+	Parts []AnswerPart
+}
+
+// AnswerPart is one sub-question of a decomposed question and its contexts.
+type AnswerPart struct {
+	Question string                    `json:"sub_question"`
+	Contexts []domain.RetrievedContext `json:"contexts"`
+}
+
+// DecomposeInput is the input of question decomposition.
+type DecomposeInput struct {
+	Question string
+	Language domain.Language
+}
+
+// ClarifyInput is the input of the ambiguity check.
+type ClarifyInput struct {
+	Question string
+	Language domain.Language
+	Context  *domain.QueryContext
+}
+
+// Clarifier is implemented by backends that can decide whether a question
+// needs a clarifying question before it can be answered.
+type Clarifier interface {
+	ClarifyQuestion(ctx context.Context, in ClarifyInput) (*domain.ClarifyResult, error)
+}
+
+// Decomposer is implemented by backends that can split a compound question
+// into sub-questions.
+type Decomposer interface {
+	DecomposeQuestion(ctx context.Context, in DecomposeInput) (*domain.DecomposeResult, error)
+}
+
+// InjectionClassifier is implemented by backends that can run the optional
+// prompt injection classifier (see guard.Classifier).
+type InjectionClassifier interface {
+	ClassifyInjection(ctx context.Context, text string) (*domain.InjectionVerdict, error)
+}
+
 // GeminiClient implements LLM using the google.golang.org/genai SDK.
 type GeminiClient struct {
 	client       *genai.Client
 	model        string
 	rewriteModel string
-	prompts      *PromptTemplates
+	prompts      *PromptStore
+	budgets      TokenBudgets
+	cache        *systemCache
+	glossary     string
 }
 
 // NewGeminiClient creates a new Gemini client via Vertex AI backend.
-func NewGeminiClient(ctx context.Context, projectID, region, model, rewriteModel string, prompts *PromptTemplates) (*GeminiClient, error) {
+func NewGeminiClient(ctx context.Context, projectID, region, model, rewriteModel string, prompts *PromptStore) (*GeminiClient, error) {
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
 		Project:  projectID,
 		Location: region,
@@ -43,74 +115,353 @@ func NewGeminiClient(ctx context.Context, projectID, region, model, rewriteModel
 	}, nil
 }
 
-func (c *GeminiClient) RewriteQuery(ctx context.Context, questionJA string, queryCtx *domain.QueryContext) (*domain.RewriteResult, error) {
-	contextJSON := "{}"
-	if queryCtx != nil {
-		b, _ := json.Marshal(queryCtx)
-		contextJSON = string(b)
+// WithModels returns a client that shares the underlying genai client but
+// uses different generation and rewrite models.
+func (c *GeminiClient) WithModels(model, rewriteModel string) *GeminiClient {
+	clone := *c
+	clone.model = model
+	clone.rewriteModel = rewriteModel
+	return &clone
+}
+
+// SetContextBudgets configures the context token budget per answer model.
+func (c *GeminiClient) SetContextBudgets(b TokenBudgets) {
+	c.budgets = b
+}
+
+// EnableContextCache serves system instructions from Vertex cached contents.
+// Clones made with WithModels share the cache.
+func (c *GeminiClient) EnableContextCache(cfg CacheConfig) {
+	c.cache = newSystemCache(c.client.Caches, cfg)
+}
+
+// SetGlossary appends a glossary preamble to the rewrite and answer system
+// instructions. With context caching it is cached along with them.
+func (c *GeminiClient) SetGlossary(glossary string) {
+	c.glossary = strings.TrimSpace(glossary)
+}
+
+// withGlossary appends the glossary preamble to a system instruction.
+func (c *GeminiClient) withGlossary(system string) string {
+	if c.glossary == "" {
+		return system
 	}
+	return system + "\n\n# Glossary\n\n" + c.glossary
+}
 
-	userPrompt := RenderTemplate(c.prompts.RewriteUser, map[string]string{
-		"question_ja":  questionJA,
-		"context_json": contextJSON,
-	})
+func (c *GeminiClient) RewriteQuery(ctx context.Context, in RewriteInput) (*domain.RewriteResult, error) {
+	prompts := c.prompts.templates(ctx)
+	userPrompt, err := renderRewriteUser(prompts, in)
+	if err != nil {
+		return nil, err
+	}
 
-	resp, err := c.client.Models.GenerateContent(ctx,
-		c.rewriteModel,
-		[]*genai.Content{
-			{Parts: []*genai.Part{{Text: userPrompt}}, Role: "user"},
-		},
-		&genai.GenerateContentConfig{
-			SystemInstruction: &genai.Content{
-				Parts: []*genai.Part{{Text: c.prompts.RewriteSystem}},
-			},
-			ResponseMIMEType: "application/json",
-			Temperature:      genai.Ptr[float32](0.2),
-		},
-	)
+	system := c.withGlossary(prompts.RewriteSystem)
+	resp, usage, err := c.generate(ctx, c.rewriteModel, system, userPrompt, 0.2, rewriteMaxTokens)
 	if err != nil {
 		return nil, fmt.Errorf("rewrite query: %w", err)
 	}
 
-	text := resp.Text()
-	var result domain.RewriteResult
-	if err := json.Unmarshal([]byte(text), &result); err != nil {
-		return nil, fmt.Errorf("parse rewrite response: %w (raw: %s)", err, truncate(text, 200))
+	result, err := parseRewriteResponse(resp.Text())
+	if err != nil {
+		return nil, err
 	}
+	result.Model = c.rewriteModel
+	result.Usage = usage
+	result.Prompt = newPromptSize(system, userPrompt)
+	return result, nil
+}
 
-	return &result, nil
+func (c *GeminiClient) GenerateAnswer(ctx context.Context, in AnswerInput) (*domain.AnswerResult, error) {
+	prompts := c.prompts.templates(ctx)
+	userPrompt, warnings, err := renderAnswerUser(prompts, in, c.budgets.For(c.model))
+	if err != nil {
+		return nil, err
+	}
+
+	system := c.withGlossary(prompts.AnswerSystem)
+	resp, usage, err := c.generate(ctx, c.model, system, userPrompt, 0.3, 16384)
+	if err != nil {
+		return nil, fmt.Errorf("generate answer: %w", err)
+	}
+
+	result, err := parseAnswerResponse(resp.Text(), in.SourceURL)
+	if err != nil {
+		return nil, err
+	}
+	result.Model = c.model
+	result.Warnings = warnings
+	result.Usage = usage
+	result.Prompt = newPromptSize(system, userPrompt)
+	return result, nil
 }
 
-func (c *GeminiClient) GenerateAnswer(ctx context.Context, questionJA string, contexts []domain.RetrievedContext, sourceURL string) (*domain.AnswerResult, error) {
-	contextsJSON, _ := json.Marshal(contexts)
+// ClassifyInjection asks the rewrite model whether text is a prompt injection attempt.
+func (c *GeminiClient) ClassifyInjection(ctx context.Context, text string) (*domain.InjectionVerdict, error) {
+	prompts := c.prompts.templates(ctx)
+	if prompts.InjectionSystem == "" || prompts.InjectionUser == nil {
+		return nil, errInjectionPromptMissing
+	}
+	userPrompt, err := prompts.InjectionUser.Render(map[string]string{"question": text})
+	if err != nil {
+		return nil, err
+	}
 
-	userPrompt := RenderTemplate(c.prompts.AnswerUser, map[string]string{
-		"question_ja":   questionJA,
-		"contexts_json": string(contextsJSON),
-	})
+	resp, usage, err := c.generate(ctx, c.rewriteModel, prompts.InjectionSystem, userPrompt, 0, 256)
+	if err != nil {
+		return nil, fmt.Errorf("classify injection: %w", err)
+	}
+	verdict, err := parseInjectionVerdict(resp.Text())
+	if err != nil {
+		return nil, err
+	}
+	verdict.Model = c.rewriteModel
+	verdict.Usage = usage
+	verdict.Prompt = newPromptSize(prompts.InjectionSystem, userPrompt)
+	return verdict, nil
+}
 
-	resp, err := c.client.Models.GenerateContent(ctx,
-		c.model,
-		[]*genai.Content{
-			{Parts: []*genai.Part{{Text: userPrompt}}, Role: "user"},
-		},
-		&genai.GenerateContentConfig{
-			SystemInstruction: &genai.Content{
-				Parts: []*genai.Part{{Text: c.prompts.AnswerSystem}},
-			},
-			ResponseMIMEType: "application/json",
-			Temperature:      genai.Ptr[float32](0.3),
-			MaxOutputTokens:  16384,
-		},
-	)
+// DecomposeQuestion asks the rewrite model to split a compound question into sub-questions.
+func (c *GeminiClient) DecomposeQuestion(ctx context.Context, in DecomposeInput) (*domain.DecomposeResult, error) {
+	prompts := c.prompts.templates(ctx)
+	if prompts.DecomposeSystem == "" || prompts.DecomposeUser == nil {
+		return nil, errDecomposePromptMissing
+	}
+	userPrompt, err := renderDecomposeUser(prompts, in)
 	if err != nil {
-		return nil, fmt.Errorf("generate answer: %w", err)
+		return nil, err
+	}
+
+	resp, usage, err := c.generate(ctx, c.rewriteModel, prompts.DecomposeSystem, userPrompt, 0, 1024)
+	if err != nil {
+		return nil, fmt.Errorf("decompose question: %w", err)
+	}
+
+	result, err := parseDecomposeResponse(resp.Text())
+	if err != nil {
+		return nil, err
+	}
+	result.Model = c.rewriteModel
+	result.Usage = usage
+	result.Prompt = newPromptSize(prompts.DecomposeSystem, userPrompt)
+	return result, nil
+}
+
+// ClarifyQuestion asks the rewrite model whether the question needs clarification.
+func (c *GeminiClient) ClarifyQuestion(ctx context.Context, in ClarifyInput) (*domain.ClarifyResult, error) {
+	prompts := c.prompts.templates(ctx)
+	if prompts.ClarifySystem == "" || prompts.ClarifyUser == nil {
+		return nil, errClarifyPromptMissing
+	}
+	userPrompt, err := renderClarifyUser(prompts, in)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, usage, err := c.generate(ctx, c.rewriteModel, prompts.ClarifySystem, userPrompt, 0, 1024)
+	if err != nil {
+		return nil, fmt.Errorf("clarify question: %w", err)
+	}
+
+	result, err := parseClarifyResponse(resp.Text())
+	if err != nil {
+		return nil, err
+	}
+	result.Model = c.rewriteModel
+	result.Usage = usage
+	result.Prompt = newPromptSize(prompts.ClarifySystem, userPrompt)
+	return result, nil
+}
+
+// generate runs a JSON generation call and checks how it finished. A response
+// truncated at maxTokens is retried once with a doubled limit; usage covers
+// both attempts. maxTokens 0 leaves the model default (no retry). With
+// context caching the system instruction is sent as a cached content, and a
+// call whose cache is rejected is retried uncached.
+func (c *GeminiClient) generate(ctx context.Context, model, system, user string, temperature float32, maxTokens int32) (*genai.GenerateContentResponse, *domain.Usage, error) {
+	var usage *domain.Usage
+	retried := false
+	cached := ""
+	if c.cache != nil {
+		cached = c.cache.lookup(ctx, model, system)
 	}
+	for {
+		cfg := &genai.GenerateContentConfig{
+			ResponseMIMEType: "application/json",
+			Temperature:      genai.Ptr(temperature),
+			MaxOutputTokens:  maxTokens,
+		}
+		if cached != "" {
+			cfg.CachedContent = cached
+		} else {
+			cfg.SystemInstruction = &genai.Content{
+				Parts: []*genai.Part{{Text: system}},
+			}
+		}
+		resp, err := c.client.Models.GenerateContent(ctx,
+			model,
+			[]*genai.Content{
+				{Parts: []*genai.Part{{Text: user}}, Role: "user"},
+			},
+			cfg,
+		)
+		if err != nil && cached != "" && isCacheRejected(err) {
+			slog.WarnContext(ctx, "context cache rejected; retrying uncached",
+				"request_id", logging.RequestID(ctx), "model", model, "cache", cached, "error", err)
+			c.cache.invalidate(model, system)
+			cached = ""
+			continue
+		}
+		if err != nil {
+			return nil, usage, err
+		}
+		usage = addUsage(usage, geminiUsage(model, resp.UsageMetadata))
+
+		err = checkGeminiResponse(resp)
+		if errors.Is(err, ErrTruncated) && !retried {
+			if next := retryTokens(int(maxTokens)); next > 0 {
+				slog.WarnContext(ctx, "llm output truncated; retrying with a larger token limit",
+					"request_id", logging.RequestID(ctx), "model", model, "max_tokens", maxTokens, "retry_max_tokens", next)
+				maxTokens, retried = int32(next), true
+				continue
+			}
+		}
+		if err != nil {
+			return nil, usage, err
+		}
+		return resp, usage, nil
+	}
+}
+
+// HealthCheck counts the tokens of a one-word prompt on each model, which
+// needs working credentials and an available model but generates nothing.
+func (c *GeminiClient) HealthCheck(ctx context.Context) error {
+	models := []string{c.model}
+	if c.rewriteModel != c.model {
+		models = append(models, c.rewriteModel)
+	}
+	for _, model := range models {
+		if _, err := c.client.Models.CountTokens(ctx, model, genai.Text("ping"), nil); err != nil {
+			return fmt.Errorf("count tokens (%s): %w", model, err)
+		}
+	}
+	return nil
+}
+
+func (c *GeminiClient) Close() error {
+	// The genai client doesn't have a Close method that returns error.
+	return nil
+}
+
+func renderRewriteUser(prompts *PromptTemplates, in RewriteInput) (string, error) {
+	contextJSON := "{}"
+	if in.Context != nil {
+		b, _ := json.Marshal(in.Context)
+		contextJSON = string(b)
+	}
+	vars := map[string]string{
+		"question":          in.Question,
+		"question_language": in.Language.Name(),
+		"context_json":      contextJSON,
+	}
+	tmpl := prompts.RewriteUser
+	switch {
+	case len(in.History) > 0 && prompts.RewriteFollowUpUser != nil:
+		tmpl = prompts.RewriteFollowUpUser
+		vars["history_json"] = historyJSON(in.History)
+	case in.HyDE && prompts.RewriteHyDEUser != nil:
+		tmpl = prompts.RewriteHyDEUser
+	}
+	return tmpl.Render(vars)
+}
+
+// maxHistoryAnswerRunes clips earlier answers in history_json; the rewrite
+// only needs enough of them to resolve references.
+const maxHistoryAnswerRunes = 400
+
+// historyJSON renders conversation turns for the follow-up rewrite prompt.
+func historyJSON(turns []domain.Turn) string {
+	clipped := make([]domain.Turn, len(turns))
+	for i, t := range turns {
+		if r := []rune(t.Answer); len(r) > maxHistoryAnswerRunes {
+			t.Answer = string(r[:maxHistoryAnswerRunes]) + "..."
+		}
+		clipped[i] = t
+	}
+	b, _ := json.Marshal(clipped)
+	return string(b)
+}
+
+// renderAnswerUser packs the contexts into budget tokens and renders the
+// answer prompt. Decomposed questions use the answer_synthesis_user section
+// when it is defined; otherwise their contexts are flattened.
+func renderAnswerUser(prompts *PromptTemplates, in AnswerInput, budget int) (string, []string, error) {
+	if len(in.Parts) > 0 && prompts.AnswerSynthesisUser != nil {
+		parts, packed := PackParts(in.Parts, budget)
+		partsJSON, _ := json.Marshal(parts)
+		out, err := prompts.AnswerSynthesisUser.Render(map[string]string{
+			"question":           in.Question,
+			"answer_language":    in.Language.Name(),
+			"sub_questions_json": string(partsJSON),
+		})
+		return out, packed.Warnings(budget), err
+	}
+
+	contexts := in.Contexts
+	for _, p := range in.Parts {
+		contexts = append(contexts, p.Contexts...)
+	}
+	packed := PackContexts(contexts, budget)
+	contextsJSON, _ := json.Marshal(packed.Contexts)
+	out, err := prompts.AnswerUser.Render(map[string]string{
+		"question":        in.Question,
+		"answer_language": in.Language.Name(),
+		"contexts_json":   string(contextsJSON),
+	})
+	return out, packed.Warnings(budget), err
+}
+
+// renderClarifyUser renders the ambiguity check prompt.
+func renderClarifyUser(prompts *PromptTemplates, in ClarifyInput) (string, error) {
+	contextJSON := "{}"
+	if in.Context != nil {
+		b, _ := json.Marshal(in.Context)
+		contextJSON = string(b)
+	}
+	return prompts.ClarifyUser.Render(map[string]string{
+		"question":          in.Question,
+		"question_language": in.Language.Name(),
+		"context_json":      contextJSON,
+	})
+}
+
+// renderDecomposeUser renders the decomposition prompt.
+func renderDecomposeUser(prompts *PromptTemplates, in DecomposeInput) (string, error) {
+	return prompts.DecomposeUser.Render(map[string]string{
+		"question":          in.Question,
+		"question_language": in.Language.Name(),
+	})
+}
 
-	text := resp.Text()
-	var result domain.AnswerResult
-	if err := json.Unmarshal([]byte(text), &result); err != nil {
-		return nil, fmt.Errorf("parse answer response: %w (raw: %s)", err, truncate(text, 200))
+func parseRewriteResponse(text string) (*domain.RewriteResult, error) {
+	var result domain.RewriteResult
+	if err := json.Unmarshal([]byte(extractJSON(text)), &result); err != nil {
+		return nil, fmt.Errorf("parse rewrite response: %w: %w (raw: %s)", ErrInvalidOutput, err, truncate(text, 200))
+	}
+	return &result, nil
+}
+
+func parseAnswerResponse(text, sourceURL string) (*domain.AnswerResult, error) {
+	var raw struct {
+		domain.AnswerResult
+		AnswerJA string `json:"answer_ja"` // emitted by prompts written before multi-language support
+	}
+	if err := json.Unmarshal([]byte(extractJSON(text)), &raw); err != nil {
+		return nil, fmt.Errorf("parse answer response: %w: %w (raw: %s)", ErrInvalidOutput, err, truncate(text, 200))
+	}
+	result := raw.AnswerResult
+	if result.Answer == "" {
+		result.Answer = raw.AnswerJA
 	}
 
 	// Enforce citation constraints.
@@ -124,9 +475,59 @@ func (c *GeminiClient) GenerateAnswer(ctx context.Context, questionJA string, co
 	return &result, nil
 }
 
-func (c *GeminiClient) Close() error {
-	// The genai client doesn't have a Close method that returns error.
-	return nil
+var errInjectionPromptMissing = errors.New("injection_classifier_system/user prompt sections are not defined")
+
+func parseInjectionVerdict(text string) (*domain.InjectionVerdict, error) {
+	var v domain.InjectionVerdict
+	if err := json.Unmarshal([]byte(extractJSON(text)), &v); err != nil {
+		return nil, fmt.Errorf("parse injection verdict: %w: %w (raw: %s)", ErrInvalidOutput, err, truncate(text, 200))
+	}
+	return &v, nil
+}
+
+var errDecomposePromptMissing = errors.New("question_decompose_system/user prompt sections are not defined")
+
+func parseDecomposeResponse(text string) (*domain.DecomposeResult, error) {
+	var result domain.DecomposeResult
+	if err := json.Unmarshal([]byte(extractJSON(text)), &result); err != nil {
+		return nil, fmt.Errorf("parse decompose response: %w: %w (raw: %s)", ErrInvalidOutput, err, truncate(text, 200))
+	}
+	subs := result.SubQuestions[:0]
+	for _, q := range result.SubQuestions {
+		if q = strings.TrimSpace(q); q != "" {
+			subs = append(subs, q)
+		}
+	}
+	result.SubQuestions = subs
+	return &result, nil
+}
+
+var errClarifyPromptMissing = errors.New("clarification_system/user prompt sections are not defined")
+
+func parseClarifyResponse(text string) (*domain.ClarifyResult, error) {
+	var result domain.ClarifyResult
+	if err := json.Unmarshal([]byte(extractJSON(text)), &result); err != nil {
+		return nil, fmt.Errorf("parse clarify response: %w: %w (raw: %s)", ErrInvalidOutput, err, truncate(text, 200))
+	}
+	return &result, nil
+}
+
+// extractJSON strips markdown code fences and surrounding prose that some
+// models emit around a JSON object, even when asked for JSON only.
+func extractJSON(text string) string {
+	s := strings.TrimSpace(text)
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```json")
+		s = strings.TrimPrefix(s, "```")
+		s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+		s = strings.TrimSpace(s)
+	}
+	start := strings.Index(s, "{")
+	end := strings.LastIndex(s, "}")
+	if start < 0 || end < start {
+		return s
+	}
+	return s[start : end+1]
 }
 
 // enforceWordLimit truncates text to maxWords and appends "..." if truncated.
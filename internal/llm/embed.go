@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/genai"
+)
+
+// DefaultEmbeddingModel is a multilingual Vertex AI embedding model, so
+// Japanese and English questions embed alike.
+const DefaultEmbeddingModel = "text-multilingual-embedding-002"
+
+// VertexEmbedder embeds text with a Vertex AI embedding model. It implements
+// answercache.Embedder.
+type VertexEmbedder struct {
+	client *genai.Client
+	model  string
+}
+
+// NewVertexEmbedder creates an embedder via the Vertex AI backend.
+func NewVertexEmbedder(ctx context.Context, projectID, region, model string) (*VertexEmbedder, error) {
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		Project:  projectID,
+		Location: region,
+		Backend:  genai.BackendVertexAI,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create genai client: %w", err)
+	}
+	return &VertexEmbedder{client: client, model: model}, nil
+}
+
+func (e *VertexEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	resp, err := e.client.Models.EmbedContent(ctx, e.model, genai.Text(text), &genai.EmbedContentConfig{
+		TaskType: "SEMANTIC_SIMILARITY",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("embed content: %w", err)
+	}
+	if len(resp.Embeddings) == 0 || len(resp.Embeddings[0].Values) == 0 {
+		return nil, errors.New("embed content: empty embedding")
+	}
+	return resp.Embeddings[0].Values, nil
+}
@@ -0,0 +1,288 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/logging"
+	"google.golang.org/genai"
+)
+
+// ErrorClass groups LLM call failures for fallback decisions.
+type ErrorClass string
+
+const (
+	ErrClassOverloaded    ErrorClass = "overloaded"
+	ErrClassQuota         ErrorClass = "quota"
+	ErrClassTimeout       ErrorClass = "timeout"
+	ErrClassInvalidOutput ErrorClass = "invalid_output"
+	ErrClassSafety        ErrorClass = "safety"
+	ErrClassOther         ErrorClass = "other"
+)
+
+// DefaultFallbackOn lists the error classes that fall through to the next
+// model when no explicit rules are configured.
+var DefaultFallbackOn = []ErrorClass{ErrClassOverloaded, ErrClassQuota, ErrClassTimeout}
+
+// ErrInvalidOutput marks a model response that could not be parsed.
+var ErrInvalidOutput = errors.New("invalid model output")
+
+// StatusError is returned by HTTP-based backends for non-200 responses.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.Code, e.Message)
+}
+
+// ParseErrorClasses parses a comma-separated list such as "overloaded,quota".
+func ParseErrorClasses(s string) ([]ErrorClass, error) {
+	var classes []ErrorClass
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		switch c := ErrorClass(part); c {
+		case ErrClassOverloaded, ErrClassQuota, ErrClassTimeout, ErrClassInvalidOutput, ErrClassSafety, ErrClassOther:
+			classes = append(classes, c)
+		default:
+			return nil, fmt.Errorf("unknown error class %q", part)
+		}
+	}
+	return classes, nil
+}
+
+// ClassifyError maps a backend error to an ErrorClass.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, ErrInvalidOutput) || errors.Is(err, ErrTruncated) {
+		return ErrClassInvalidOutput
+	}
+	if errors.Is(err, ErrSafetyBlocked) || errors.Is(err, ErrRecitation) {
+		return ErrClassSafety
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrClassTimeout
+	}
+
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		if c := classifyStatus(apiErr.Code); c != ErrClassOther {
+			return c
+		}
+		switch {
+		case strings.Contains(apiErr.Status, "RESOURCE_EXHAUSTED"):
+			return ErrClassQuota
+		case strings.Contains(apiErr.Status, "UNAVAILABLE"):
+			return ErrClassOverloaded
+		case strings.Contains(apiErr.Status, "DEADLINE_EXCEEDED"):
+			return ErrClassTimeout
+		}
+		return ErrClassOther
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return classifyStatus(statusErr.Code)
+	}
+
+	// Connection refused, DNS failures etc. — typically a local server that is down.
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrClassTimeout
+		}
+		return ErrClassOverloaded
+	}
+
+	return ErrClassOther
+}
+
+func classifyStatus(code int) ErrorClass {
+	switch code {
+	case http.StatusTooManyRequests:
+		return ErrClassQuota
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return ErrClassOverloaded
+	case http.StatusGatewayTimeout:
+		return ErrClassTimeout
+	}
+	return ErrClassOther
+}
+
+// Backend is a named entry in a fallback chain.
+type Backend struct {
+	Name string
+	LLM  LLM
+}
+
+// FallbackLLM implements LLM by trying an ordered list of backends per stage,
+// falling through to the next one when the error class is allowed.
+type FallbackLLM struct {
+	rewrite []Backend
+	answer  []Backend
+	fallOn  map[ErrorClass]bool
+}
+
+// NewFallbackLLM creates a fallback chain. Each stage needs at least one backend.
+func NewFallbackLLM(rewrite, answer []Backend, fallOn []ErrorClass) (*FallbackLLM, error) {
+	if len(rewrite) == 0 || len(answer) == 0 {
+		return nil, fmt.Errorf("fallback chain needs at least one rewrite and one answer backend")
+	}
+	m := make(map[ErrorClass]bool, len(fallOn))
+	for _, c := range fallOn {
+		m[c] = true
+	}
+	return &FallbackLLM{rewrite: rewrite, answer: answer, fallOn: m}, nil
+}
+
+// RewriteQuery runs the rewrite chain.
+func (f *FallbackLLM) RewriteQuery(ctx context.Context, in RewriteInput) (*domain.RewriteResult, error) {
+	return runChain(ctx, f, "rewrite", f.rewrite, func(b Backend) (*domain.RewriteResult, error) {
+		res, err := b.LLM.RewriteQuery(ctx, in)
+		if err == nil && res.Model == "" {
+			res.Model = b.Name
+		}
+		return res, err
+	})
+}
+
+// GenerateAnswer runs the answer chain.
+func (f *FallbackLLM) GenerateAnswer(ctx context.Context, in AnswerInput) (*domain.AnswerResult, error) {
+	return runChain(ctx, f, "answer", f.answer, func(b Backend) (*domain.AnswerResult, error) {
+		res, err := b.LLM.GenerateAnswer(ctx, in)
+		if err == nil && res.Model == "" {
+			res.Model = b.Name
+		}
+		return res, err
+	})
+}
+
+// HealthCheck checks each backend once. It fails when a stage has no
+// healthy backend; an unhealthy backend with a healthy fallback is fine.
+func (f *FallbackLLM) HealthCheck(ctx context.Context) error {
+	checked := map[string]error{}
+	stage := func(name string, chain []Backend) error {
+		var errs []error
+		for _, b := range chain {
+			err, ok := checked[b.Name]
+			if !ok {
+				err = b.LLM.HealthCheck(ctx)
+				checked[b.Name] = err
+			}
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+		}
+		return fmt.Errorf("%s: no healthy backend: %w", name, errors.Join(errs...))
+	}
+	return errors.Join(stage("rewrite", f.rewrite), stage("answer", f.answer))
+}
+
+// runChain calls each backend of chain in order until one succeeds or its
+// error class may not fall through, and returns the last error otherwise.
+func runChain[T any](ctx context.Context, f *FallbackLLM, stage string, chain []Backend, call func(Backend) (T, error)) (T, error) {
+	var zero T
+	if len(chain) == 0 {
+		return zero, fmt.Errorf("no backend supports the %s stage", stage)
+	}
+	var lastErr error
+	for i, b := range chain {
+		res, err := call(b)
+		if err == nil {
+			return res, nil
+		}
+		lastErr = fmt.Errorf("%s: %w", b.Name, err)
+		if !f.shouldFallThrough(ctx, stage, b.Name, err, i == len(chain)-1) {
+			break
+		}
+	}
+	return zero, lastErr
+}
+
+// supporting returns the backends of chain that implement the optional
+// interface I, in order.
+func supporting[I any](chain []Backend) []Backend {
+	var out []Backend
+	for _, b := range chain {
+		if _, ok := b.LLM.(I); ok {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func (f *FallbackLLM) shouldFallThrough(ctx context.Context, stage, name string, err error, last bool) bool {
+	class := ClassifyError(err)
+	fallThrough := !last && ctx.Err() == nil && f.fallOn[class]
+	slog.WarnContext(ctx, "llm backend failed",
+		"request_id", logging.RequestID(ctx),
+		"stage", stage,
+		"model", name,
+		"error_class", string(class),
+		"fall_through", fallThrough,
+		"error", err,
+	)
+	return fallThrough
+}
+
+// ClassifyInjection runs the rewrite chain's classifier-capable backends.
+func (f *FallbackLLM) ClassifyInjection(ctx context.Context, text string) (*domain.InjectionVerdict, error) {
+	return runChain(ctx, f, "injection_classifier", supporting[InjectionClassifier](f.rewrite), func(b Backend) (*domain.InjectionVerdict, error) {
+		res, err := b.LLM.(InjectionClassifier).ClassifyInjection(ctx, text)
+		if err == nil && res.Model == "" {
+			res.Model = b.Name
+		}
+		return res, err
+	})
+}
+
+// DecomposeQuestion runs the rewrite chain's decomposition-capable backends.
+func (f *FallbackLLM) DecomposeQuestion(ctx context.Context, in DecomposeInput) (*domain.DecomposeResult, error) {
+	return runChain(ctx, f, "decompose", supporting[Decomposer](f.rewrite), func(b Backend) (*domain.DecomposeResult, error) {
+		res, err := b.LLM.(Decomposer).DecomposeQuestion(ctx, in)
+		if err == nil && res.Model == "" {
+			res.Model = b.Name
+		}
+		return res, err
+	})
+}
+
+// ClarifyQuestion runs the rewrite chain's clarification-capable backends.
+func (f *FallbackLLM) ClarifyQuestion(ctx context.Context, in ClarifyInput) (*domain.ClarifyResult, error) {
+	return runChain(ctx, f, "clarify", supporting[Clarifier](f.rewrite), func(b Backend) (*domain.ClarifyResult, error) {
+		res, err := b.LLM.(Clarifier).ClarifyQuestion(ctx, in)
+		if err == nil && res.Model == "" {
+			res.Model = b.Name
+		}
+		return res, err
+	})
+}
+
+// Close closes every distinct backend in the chain once.
+func (f *FallbackLLM) Close() error {
+	seen := make(map[LLM]bool)
+	var errs []error
+	for _, b := range append(append([]Backend{}, f.rewrite...), f.answer...) {
+		if seen[b.LLM] {
+			continue
+		}
+		seen[b.LLM] = true
+		if err := b.LLM.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"google.golang.org/genai"
+)
+
+type stubLLM struct {
+	model     string
+	err       error
+	healthErr error
+	calls     int
+}
+
+func (s *stubLLM) RewriteQuery(_ context.Context, _ RewriteInput) (*domain.RewriteResult, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &domain.RewriteResult{QueryEN: "q", CallInfo: domain.CallInfo{Model: s.model}}, nil
+}
+
+func (s *stubLLM) GenerateAnswer(_ context.Context, _ AnswerInput) (*domain.AnswerResult, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &domain.AnswerResult{Answer: "a", CallInfo: domain.CallInfo{Model: s.model}}, nil
+}
+
+func (s *stubLLM) HealthCheck(context.Context) error { return s.healthErr }
+
+func (s *stubLLM) Close() error { return nil }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{genai.APIError{Code: 429, Status: "RESOURCE_EXHAUSTED"}, ErrClassQuota},
+		{fmt.Errorf("wrapped: %w", genai.APIError{Code: 503}), ErrClassOverloaded},
+		{&StatusError{Code: 504}, ErrClassTimeout},
+		{fmt.Errorf("x: %w", context.DeadlineExceeded), ErrClassTimeout},
+		{fmt.Errorf("parse: %w", ErrInvalidOutput), ErrClassInvalidOutput},
+		{&FinishError{Reason: "MAX_TOKENS", cause: ErrTruncated}, ErrClassInvalidOutput},
+		{fmt.Errorf("answer: %w", &FinishError{Reason: "SAFETY", cause: ErrSafetyBlocked}), ErrClassSafety},
+		{genai.APIError{Code: 400, Status: "INVALID_ARGUMENT"}, ErrClassOther},
+		{errors.New("boom"), ErrClassOther},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("ClassifyError(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestFallbackLLM_FallsThroughOnQuota(t *testing.T) {
+	primary := &stubLLM{model: "flash", err: genai.APIError{Code: 429}}
+	secondary := &stubLLM{model: "flash-lite"}
+	f, err := NewFallbackLLM(
+		[]Backend{{Name: "flash", LLM: primary}, {Name: "flash-lite", LLM: secondary}},
+		[]Backend{{Name: "flash", LLM: primary}, {Name: "flash-lite", LLM: secondary}},
+		DefaultFallbackOn,
+	)
+	if err != nil {
+		t.Fatalf("NewFallbackLLM: %v", err)
+	}
+
+	ans, err := f.GenerateAnswer(context.Background(), AnswerInput{Question: "q"})
+	if err != nil {
+		t.Fatalf("GenerateAnswer: %v", err)
+	}
+	if ans.Model != "flash-lite" {
+		t.Errorf("expected flash-lite to answer, got %q", ans.Model)
+	}
+}
+
+func TestFallbackLLM_StopsOnNonRetryableClass(t *testing.T) {
+	primary := &stubLLM{model: "flash", err: genai.APIError{Code: 400}}
+	secondary := &stubLLM{model: "flash-lite"}
+	f, _ := NewFallbackLLM(
+		[]Backend{{Name: "flash", LLM: primary}, {Name: "flash-lite", LLM: secondary}},
+		[]Backend{{Name: "flash", LLM: primary}},
+		DefaultFallbackOn,
+	)
+
+	if _, err := f.RewriteQuery(context.Background(), RewriteInput{Question: "q"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if secondary.calls != 0 {
+		t.Errorf("expected secondary not to be called, got %d calls", secondary.calls)
+	}
+}
+
+func TestFallbackLLM_HealthCheck(t *testing.T) {
+	down := &stubLLM{model: "flash", healthErr: errors.New("permission denied")}
+	up := &stubLLM{model: "local"}
+	ctx := context.Background()
+
+	f, _ := NewFallbackLLM(
+		[]Backend{{Name: "flash", LLM: down}, {Name: "local", LLM: up}},
+		[]Backend{{Name: "flash", LLM: down}, {Name: "local", LLM: up}},
+		DefaultFallbackOn,
+	)
+	if err := f.HealthCheck(ctx); err != nil {
+		t.Errorf("a healthy fallback should keep the chain healthy: %v", err)
+	}
+
+	f, _ = NewFallbackLLM(
+		[]Backend{{Name: "local", LLM: up}},
+		[]Backend{{Name: "flash", LLM: down}},
+		DefaultFallbackOn,
+	)
+	err := f.HealthCheck(ctx)
+	if err == nil || !strings.Contains(err.Error(), "answer: no healthy backend") || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected the answer stage to be unhealthy, got %v", err)
+	}
+}
+
+func TestParseErrorClasses(t *testing.T) {
+	got, err := ParseErrorClasses("quota, timeout")
+	if err != nil || len(got) != 2 || got[0] != ErrClassQuota || got[1] != ErrClassTimeout {
+		t.Errorf("unexpected result %v, %v", got, err)
+	}
+	if _, err := ParseErrorClasses("nope"); err == nil {
+		t.Error("expected error for unknown class")
+	}
+}
@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// Sentinel causes of a FinishError.
+var (
+	// ErrSafetyBlocked means the prompt or the response was blocked by safety filters.
+	ErrSafetyBlocked = errors.New("blocked by safety filters")
+	// ErrRecitation means the response was stopped for reciting copyrighted text.
+	ErrRecitation = errors.New("stopped for recitation")
+	// ErrTruncated means the response hit the output token limit.
+	ErrTruncated = errors.New("output truncated at the token limit")
+)
+
+// maxOutputTokensLimit caps the output token limit used when retrying a
+// truncated response.
+const maxOutputTokensLimit = 65536
+
+// FinishError reports a response that did not finish normally. It unwraps to
+// one of ErrSafetyBlocked, ErrRecitation or ErrTruncated.
+type FinishError struct {
+	// Reason is the backend's finish or block reason, e.g. "SAFETY" or "prompt:PROHIBITED_CONTENT".
+	Reason string
+	// Detail lists blocked safety categories, when reported.
+	Detail string
+	cause  error
+}
+
+func (e *FinishError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%v (reason %s: %s)", e.cause, e.Reason, e.Detail)
+	}
+	return fmt.Sprintf("%v (reason %s)", e.cause, e.Reason)
+}
+
+func (e *FinishError) Unwrap() error { return e.cause }
+
+// checkGeminiResponse inspects prompt feedback and the first candidate's
+// finish reason before the response text is parsed.
+func checkGeminiResponse(resp *genai.GenerateContentResponse) error {
+	if fb := resp.PromptFeedback; fb != nil && fb.BlockReason != "" && fb.BlockReason != genai.BlockedReasonUnspecified {
+		return &FinishError{Reason: "prompt:" + string(fb.BlockReason), Detail: blockedCategories(fb.SafetyRatings), cause: ErrSafetyBlocked}
+	}
+	if len(resp.Candidates) == 0 {
+		return nil // surfaces as an invalid output when parsed
+	}
+	cand := resp.Candidates[0]
+	switch cand.FinishReason {
+	case genai.FinishReasonMaxTokens:
+		return &FinishError{Reason: string(cand.FinishReason), cause: ErrTruncated}
+	case genai.FinishReasonSafety, genai.FinishReasonBlocklist, genai.FinishReasonProhibitedContent, genai.FinishReasonSPII:
+		return &FinishError{Reason: string(cand.FinishReason), Detail: blockedCategories(cand.SafetyRatings), cause: ErrSafetyBlocked}
+	case genai.FinishReasonRecitation:
+		return &FinishError{Reason: string(cand.FinishReason), cause: ErrRecitation}
+	}
+	return nil
+}
+
+func blockedCategories(ratings []*genai.SafetyRating) string {
+	var cats []string
+	for _, r := range ratings {
+		if r != nil && r.Blocked {
+			cats = append(cats, string(r.Category))
+		}
+	}
+	return strings.Join(cats, ",")
+}
+
+// checkOpenAIFinish maps OpenAI-compatible finish reasons.
+func checkOpenAIFinish(reason string) error {
+	switch reason {
+	case "length":
+		return &FinishError{Reason: reason, cause: ErrTruncated}
+	case "content_filter":
+		return &FinishError{Reason: reason, cause: ErrSafetyBlocked}
+	}
+	return nil
+}
+
+// rewriteMaxTokens is the output limit of query rewriting. It is explicit,
+// rather than the model default, so a truncated rewrite (a long HyDE
+// passage) is retried like the other stages.
+const rewriteMaxTokens = 2048
+
+// retryTokens returns the output token limit for retrying a truncated
+// response, or 0 if the limit cannot be raised.
+func retryTokens(current int) int {
+	if current <= 0 || current >= maxOutputTokensLimit {
+		return 0
+	}
+	return min(current*2, maxOutputTokensLimit)
+}
@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestCheckGeminiResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *genai.GenerateContentResponse
+		want error
+	}{
+		{"stop", &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonStop}}}, nil},
+		{"no candidates", &genai.GenerateContentResponse{}, nil},
+		{"prompt blocked", &genai.GenerateContentResponse{
+			PromptFeedback: &genai.GenerateContentResponsePromptFeedback{BlockReason: genai.BlockedReasonProhibitedContent},
+		}, ErrSafetyBlocked},
+		{"max tokens", &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonMaxTokens}}}, ErrTruncated},
+		{"safety", &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonSafety}}}, ErrSafetyBlocked},
+		{"recitation", &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonRecitation}}}, ErrRecitation},
+	}
+	for _, tt := range tests {
+		err := checkGeminiResponse(tt.resp)
+		if tt.want == nil && err != nil || !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCheckGeminiResponse_ReportsBlockedCategories(t *testing.T) {
+	err := checkGeminiResponse(&genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+		FinishReason: genai.FinishReasonSafety,
+		SafetyRatings: []*genai.SafetyRating{
+			{Category: genai.HarmCategoryHarassment},
+			{Category: genai.HarmCategoryDangerousContent, Blocked: true},
+		},
+	}}})
+	if err == nil || !strings.Contains(err.Error(), "HARM_CATEGORY_DANGEROUS_CONTENT") || strings.Contains(err.Error(), "HARASSMENT") {
+		t.Errorf("expected only the blocked category in the error, got %v", err)
+	}
+}
+
+func TestRetryTokens(t *testing.T) {
+	for _, tt := range []struct{ in, want int }{{0, 0}, {256, 512}, {40000, 65536}, {65536, 0}} {
+		if got := retryTokens(tt.in); got != tt.want {
+			t.Errorf("retryTokens(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"github.com/shunpei/rulegate/internal/logging"
+)
+
+// OpenAIClient implements LLM against any OpenAI-compatible chat completions
+// endpoint (llama.cpp server, Ollama, vLLM, ...).
+type OpenAIClient struct {
+	httpClient   *http.Client
+	baseURL      string
+	apiKey       string
+	model        string
+	rewriteModel string
+	jsonMode     bool
+	prompts      *PromptStore
+	budgets      TokenBudgets
+}
+
+// NewOpenAIClient creates a client for an OpenAI-compatible server.
+// baseURL is the API root including the version segment, e.g. "http://localhost:11434/v1".
+// When jsonMode is true, requests ask the server for response_format json_object;
+// disable it for servers that reject that parameter.
+func NewOpenAIClient(baseURL, apiKey, model, rewriteModel string, jsonMode bool, prompts *PromptStore) (*OpenAIClient, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("openai base URL is required")
+	}
+	if model == "" {
+		return nil, fmt.Errorf("openai model is required")
+	}
+	if rewriteModel == "" {
+		rewriteModel = model
+	}
+	return &OpenAIClient{
+		httpClient:   &http.Client{Timeout: 120 * time.Second},
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		apiKey:       apiKey,
+		model:        model,
+		rewriteModel: rewriteModel,
+		jsonMode:     jsonMode,
+		prompts:      prompts,
+	}, nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type chatRequest struct {
+	Model          string              `json:"model"`
+	Messages       []chatMessage       `json:"messages"`
+	Temperature    float32             `json:"temperature"`
+	MaxTokens      int                 `json:"max_tokens,omitempty"`
+	ResponseFormat *chatResponseFormat `json:"response_format,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens        int `json:"prompt_tokens"`
+		CompletionTokens    int `json:"completion_tokens"`
+		PromptTokensDetails *struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details,omitempty"`
+	} `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (r *chatResponse) usage(model string) *domain.Usage {
+	if r.Usage == nil {
+		return nil
+	}
+	u := &domain.Usage{
+		Model:           model,
+		PromptTokens:    r.Usage.PromptTokens,
+		CandidateTokens: r.Usage.CompletionTokens,
+	}
+	if r.Usage.PromptTokensDetails != nil {
+		u.CachedTokens = r.Usage.PromptTokensDetails.CachedTokens
+	}
+	return u
+}
+
+// addUsage adds the token counts of an earlier attempt.
+func (r *chatResponse) addUsage(earlier *chatResponse) {
+	if earlier.Usage == nil {
+		return
+	}
+	if r.Usage == nil {
+		r.Usage = earlier.Usage
+		return
+	}
+	r.Usage.PromptTokens += earlier.Usage.PromptTokens
+	r.Usage.CompletionTokens += earlier.Usage.CompletionTokens
+	if d := earlier.Usage.PromptTokensDetails; d != nil && r.Usage.PromptTokensDetails != nil {
+		r.Usage.PromptTokensDetails.CachedTokens += d.CachedTokens
+	}
+}
+
+// SetContextBudgets configures the context token budget per answer model.
+func (c *OpenAIClient) SetContextBudgets(b TokenBudgets) {
+	c.budgets = b
+}
+
+// RewriteQuery asks the rewrite model for search queries for the question.
+func (c *OpenAIClient) RewriteQuery(ctx context.Context, in RewriteInput) (*domain.RewriteResult, error) {
+	prompts := c.prompts.templates(ctx)
+	userPrompt, err := renderRewriteUser(prompts, in)
+	if err != nil {
+		return nil, err
+	}
+
+	text, usage, err := c.chat(ctx, c.rewriteModel, prompts.RewriteSystem, userPrompt, 0.2, rewriteMaxTokens)
+	if err != nil {
+		return nil, fmt.Errorf("rewrite query: %w", err)
+	}
+
+	result, err := parseRewriteResponse(text)
+	if err != nil {
+		return nil, err
+	}
+	result.Model = c.rewriteModel
+	result.Usage = usage
+	result.Prompt = newPromptSize(prompts.RewriteSystem, userPrompt)
+	return result, nil
+}
+
+// GenerateAnswer asks the answer model to answer from the retrieved contexts.
+func (c *OpenAIClient) GenerateAnswer(ctx context.Context, in AnswerInput) (*domain.AnswerResult, error) {
+	prompts := c.prompts.templates(ctx)
+	userPrompt, warnings, err := renderAnswerUser(prompts, in, c.budgets.For(c.model))
+	if err != nil {
+		return nil, err
+	}
+
+	text, usage, err := c.chat(ctx, c.model, prompts.AnswerSystem, userPrompt, 0.3, 16384)
+	if err != nil {
+		return nil, fmt.Errorf("generate answer: %w", err)
+	}
+
+	result, err := parseAnswerResponse(text, in.SourceURL)
+	if err != nil {
+		return nil, err
+	}
+	result.Model = c.model
+	result.Warnings = warnings
+	result.Usage = usage
+	result.Prompt = newPromptSize(prompts.AnswerSystem, userPrompt)
+	return result, nil
+}
+
+// ClassifyInjection asks the rewrite model whether text is a prompt injection attempt.
+func (c *OpenAIClient) ClassifyInjection(ctx context.Context, text string) (*domain.InjectionVerdict, error) {
+	prompts := c.prompts.templates(ctx)
+	if prompts.InjectionSystem == "" || prompts.InjectionUser == nil {
+		return nil, errInjectionPromptMissing
+	}
+	userPrompt, err := prompts.InjectionUser.Render(map[string]string{"question": text})
+	if err != nil {
+		return nil, err
+	}
+
+	text, usage, err := c.chat(ctx, c.rewriteModel, prompts.InjectionSystem, userPrompt, 0, 256)
+	if err != nil {
+		return nil, fmt.Errorf("classify injection: %w", err)
+	}
+	verdict, err := parseInjectionVerdict(text)
+	if err != nil {
+		return nil, err
+	}
+	verdict.Model = c.rewriteModel
+	verdict.Usage = usage
+	verdict.Prompt = newPromptSize(prompts.InjectionSystem, userPrompt)
+	return verdict, nil
+}
+
+// DecomposeQuestion asks the rewrite model to split a compound question into sub-questions.
+func (c *OpenAIClient) DecomposeQuestion(ctx context.Context, in DecomposeInput) (*domain.DecomposeResult, error) {
+	prompts := c.prompts.templates(ctx)
+	if prompts.DecomposeSystem == "" || prompts.DecomposeUser == nil {
+		return nil, errDecomposePromptMissing
+	}
+	userPrompt, err := renderDecomposeUser(prompts, in)
+	if err != nil {
+		return nil, err
+	}
+
+	text, usage, err := c.chat(ctx, c.rewriteModel, prompts.DecomposeSystem, userPrompt, 0, 1024)
+	if err != nil {
+		return nil, fmt.Errorf("decompose question: %w", err)
+	}
+
+	result, err := parseDecomposeResponse(text)
+	if err != nil {
+		return nil, err
+	}
+	result.Model = c.rewriteModel
+	result.Usage = usage
+	result.Prompt = newPromptSize(prompts.DecomposeSystem, userPrompt)
+	return result, nil
+}
+
+// ClarifyQuestion asks the rewrite model whether the question needs clarification.
+func (c *OpenAIClient) ClarifyQuestion(ctx context.Context, in ClarifyInput) (*domain.ClarifyResult, error) {
+	prompts := c.prompts.templates(ctx)
+	if prompts.ClarifySystem == "" || prompts.ClarifyUser == nil {
+		return nil, errClarifyPromptMissing
+	}
+	userPrompt, err := renderClarifyUser(prompts, in)
+	if err != nil {
+		return nil, err
+	}
+
+	text, usage, err := c.chat(ctx, c.rewriteModel, prompts.ClarifySystem, userPrompt, 0, 1024)
+	if err != nil {
+		return nil, fmt.Errorf("clarify question: %w", err)
+	}
+
+	result, err := parseClarifyResponse(text)
+	if err != nil {
+		return nil, err
+	}
+	result.Model = c.rewriteModel
+	result.Usage = usage
+	result.Prompt = newPromptSize(prompts.ClarifySystem, userPrompt)
+	return result, nil
+}
+
+// chat sends a system and user prompt to model and returns the reply text
+// and its usage.
+func (c *OpenAIClient) chat(ctx context.Context, model, system, user string, temperature float32, maxTokens int) (string, *domain.Usage, error) {
+	resp, err := c.complete(ctx, chatRequest{
+		Model: model,
+		Messages: []chatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: user},
+		},
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return resp.content(), resp.usage(model), nil
+}
+
+func (r *chatResponse) content() string {
+	return r.Choices[0].Message.Content
+}
+
+// complete sends a chat completion request and checks how it finished. A
+// response truncated at MaxTokens is retried once with a doubled limit; the
+// returned usage covers both attempts.
+func (c *OpenAIClient) complete(ctx context.Context, req chatRequest) (*chatResponse, error) {
+	resp, err := c.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	err = checkOpenAIFinish(resp.Choices[0].FinishReason)
+	if next := retryTokens(req.MaxTokens); errors.Is(err, ErrTruncated) && next > 0 {
+		slog.WarnContext(ctx, "llm output truncated; retrying with a larger token limit",
+			"request_id", logging.RequestID(ctx), "model", req.Model, "max_tokens", req.MaxTokens, "retry_max_tokens", next)
+		first := resp
+		req.MaxTokens = next
+		if resp, err = c.post(ctx, req); err != nil {
+			return nil, err
+		}
+		resp.addUsage(first)
+		err = checkOpenAIFinish(resp.Choices[0].FinishReason)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// post sends a single chat completion request. The returned response has at least one choice.
+func (c *OpenAIClient) post(ctx context.Context, req chatRequest) (*chatResponse, error) {
+	if c.jsonMode {
+		req.ResponseFormat = &chatResponseFormat{Type: "json_object"}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("post chat completion: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	var resp chatResponse
+	decodeErr := json.Unmarshal(respBody, &resp)
+	if httpResp.StatusCode != http.StatusOK {
+		msg := truncate(string(respBody), 200)
+		if decodeErr == nil && resp.Error != nil {
+			msg = resp.Error.Message
+		}
+		return nil, fmt.Errorf("chat completion: %w", &StatusError{Code: httpResp.StatusCode, Message: msg})
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("decode response: %w (raw: %s)", decodeErr, truncate(string(respBody), 200))
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("chat completion returned no choices")
+	}
+
+	return &resp, nil
+}
+
+// HealthCheck lists the server's models.
+func (c *OpenAIClient) HealthCheck(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("list models: %w", err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(httpResp.Body, 200))
+		return fmt.Errorf("list models: %w", &StatusError{Code: httpResp.StatusCode, Message: string(body)})
+	}
+	return nil
+}
+
+func (c *OpenAIClient) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,290 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+func testPrompts() *PromptTemplates {
+	return &PromptTemplates{
+		RewriteSystem: "rewrite system",
+		RewriteUser:   MustParseTemplate("rewrite_user", "Q: {{question}} C: {{context_json}}"),
+		AnswerSystem:  "answer system",
+		AnswerUser:    MustParseTemplate("answer_user", "Q: {{question}} L: {{answer_language}} X: {{contexts_json}}"),
+	}
+}
+
+// newChatServer returns a test server that replies to every chat completion with content.
+func newChatServer(t *testing.T, content string, check func(chatRequest)) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if check != nil {
+			check(req)
+		}
+		resp := map[string]any{
+			"choices": []map[string]any{
+				{"message": map[string]string{"role": "assistant", "content": content}, "finish_reason": "stop"},
+			},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestOpenAIClient_HealthCheck(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+	c, _ := NewOpenAIClient(srv.URL+"/v1", "key", "m", "", true, StaticPrompts(testPrompts()))
+
+	if err := c.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck: %v", err)
+	}
+	status = http.StatusUnauthorized
+	var statusErr *StatusError
+	if err := c.HealthCheck(context.Background()); !errors.As(err, &statusErr) || statusErr.Code != http.StatusUnauthorized {
+		t.Errorf("expected a 401 StatusError, got %v", err)
+	}
+}
+
+func TestOpenAIClient_RewriteQuery(t *testing.T) {
+	srv := newChatServer(t, `{"q_en":"gate touch penalty","keywords_en":["gate touch"],"q_ja":"ゲート接触"}`, func(req chatRequest) {
+		if req.Model != "rewrite-model" {
+			t.Errorf("expected rewrite model, got %q", req.Model)
+		}
+		if req.ResponseFormat == nil || req.ResponseFormat.Type != "json_object" {
+			t.Error("expected json_object response format")
+		}
+		if len(req.Messages) != 2 || req.Messages[0].Content != "rewrite system" {
+			t.Errorf("unexpected messages: %+v", req.Messages)
+		}
+	})
+	defer srv.Close()
+
+	c, err := NewOpenAIClient(srv.URL+"/v1", "", "answer-model", "rewrite-model", true, StaticPrompts(testPrompts()))
+	if err != nil {
+		t.Fatalf("NewOpenAIClient: %v", err)
+	}
+
+	got, err := c.RewriteQuery(context.Background(), RewriteInput{Question: "ゲートに触ったら？", Language: domain.LangJA})
+	if err != nil {
+		t.Fatalf("RewriteQuery: %v", err)
+	}
+	if got.QueryEN != "gate touch penalty" {
+		t.Errorf("expected q_en, got %q", got.QueryEN)
+	}
+	// "rewrite system" and "Q: ゲートに触ったら？ C: {}", counted in characters.
+	if got.Prompt == nil || got.Prompt.SystemChars != 14 || got.Prompt.UserChars != 18 {
+		t.Errorf("unexpected prompt size: %+v", got.Prompt)
+	}
+}
+
+func TestOpenAIClient_RewriteQuery_HyDE(t *testing.T) {
+	srv := newChatServer(t, `{"q_en":"capsize","hypothetical_passage_en":"A capsized boat shall..."}`, func(req chatRequest) {
+		if !strings.HasPrefix(req.Messages[1].Content, "HyDE: ") {
+			t.Errorf("expected HyDE user prompt, got %q", req.Messages[1].Content)
+		}
+	})
+	defer srv.Close()
+
+	pt := testPrompts()
+	pt.RewriteHyDEUser = MustParseTemplate("rewrite_hyde_user", "HyDE: {{question}} C: {{context_json}}")
+	c, _ := NewOpenAIClient(srv.URL+"/v1", "", "m", "", true, StaticPrompts(pt))
+
+	got, err := c.RewriteQuery(context.Background(), RewriteInput{Question: "ひっくり返ったら？", HyDE: true})
+	if err != nil {
+		t.Fatalf("RewriteQuery: %v", err)
+	}
+	if got.HypotheticalEN != "A capsized boat shall..." {
+		t.Errorf("expected hypothetical passage, got %q", got.HypotheticalEN)
+	}
+}
+
+func TestOpenAIClient_RewriteQuery_FollowUp(t *testing.T) {
+	long := strings.Repeat("あ", maxHistoryAnswerRunes+50)
+	srv := newChatServer(t, `{"q_en":"gate touch C1","standalone_question":"C1でゲートに触ったら？"}`, func(req chatRequest) {
+		user := req.Messages[1].Content
+		if !strings.HasPrefix(user, "FollowUp: ") || !strings.Contains(user, `"rule_id":"29.4"`) {
+			t.Errorf("expected follow-up prompt with history, got %q", user)
+		}
+		if strings.Contains(user, long) {
+			t.Error("expected earlier answers to be clipped")
+		}
+	})
+	defer srv.Close()
+
+	pt := testPrompts()
+	pt.RewriteHyDEUser = MustParseTemplate("rewrite_hyde_user", "HyDE: {{question}} C: {{context_json}}")
+	pt.RewriteFollowUpUser = MustParseTemplate("rewrite_followup_user", "FollowUp: {{question}} C: {{context_json}} H: {{history_json}}")
+	c, _ := NewOpenAIClient(srv.URL+"/v1", "", "m", "", true, StaticPrompts(pt))
+
+	got, err := c.RewriteQuery(context.Background(), RewriteInput{
+		Question: "じゃあC1の場合は？",
+		HyDE:     true,
+		History: []domain.Turn{{
+			Question:  "K1でゲートに触ったら？",
+			Answer:    long,
+			Citations: []domain.TurnCitation{{RuleID: "29.4"}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("RewriteQuery: %v", err)
+	}
+	if got.StandaloneQuestion != "C1でゲートに触ったら？" {
+		t.Errorf("expected standalone question, got %q", got.StandaloneQuestion)
+	}
+}
+
+func TestOpenAIClient_GenerateAnswer_FencedJSON(t *testing.T) {
+	content := "```json\n{\"answer_ja\":\"2秒です\",\"citations\":[{\"rule_id\":\"29.4\",\"quote_en\":\"two\"}],\"confidence\":0.8}\n```"
+	srv := newChatServer(t, content, func(req chatRequest) {
+		if req.ResponseFormat != nil {
+			t.Error("expected no response_format when JSON mode is off")
+		}
+	})
+	defer srv.Close()
+
+	c, err := NewOpenAIClient(srv.URL+"/v1", "", "answer-model", "", false, StaticPrompts(testPrompts()))
+	if err != nil {
+		t.Fatalf("NewOpenAIClient: %v", err)
+	}
+
+	got, err := c.GenerateAnswer(context.Background(), AnswerInput{
+		Question:  "質問",
+		Language:  domain.LangJA,
+		Contexts:  []domain.RetrievedContext{{Text: "ctx", Score: 0.9}},
+		SourceURL: "https://example.com",
+	})
+	if err != nil {
+		t.Fatalf("GenerateAnswer: %v", err)
+	}
+	// Legacy "answer_ja" output is accepted as the answer.
+	if got.Answer != "2秒です" {
+		t.Errorf("expected answer, got %q", got.Answer)
+	}
+	if len(got.Citations) != 1 || got.Citations[0].SourceURL != "https://example.com" {
+		t.Errorf("expected citation with default source URL, got %+v", got.Citations)
+	}
+}
+
+func TestOpenAIClient_DecomposeQuestion(t *testing.T) {
+	srv := newChatServer(t, `{"sub_questions":["ゲート接触と不通過の違いは？"," ","再走の条件は？"]}`, nil)
+	defer srv.Close()
+
+	pt := testPrompts()
+	c, _ := NewOpenAIClient(srv.URL+"/v1", "", "m", "", true, StaticPrompts(pt))
+	if _, err := c.DecomposeQuestion(context.Background(), DecomposeInput{Question: "q"}); err != errDecomposePromptMissing {
+		t.Fatalf("expected missing prompt error, got %v", err)
+	}
+
+	pt.DecomposeSystem = "decompose"
+	pt.DecomposeUser = MustParseTemplate("decompose_user", "{{question}}")
+	got, err := c.DecomposeQuestion(context.Background(), DecomposeInput{Question: "q"})
+	if err != nil {
+		t.Fatalf("DecomposeQuestion: %v", err)
+	}
+	if len(got.SubQuestions) != 2 || got.SubQuestions[1] != "再走の条件は？" {
+		t.Errorf("expected two non-empty sub-questions, got %q", got.SubQuestions)
+	}
+}
+
+// newTruncatingServer returns a test server whose first reply is cut off at
+// the token limit and whose later replies are complete, recording the
+// max_tokens of each request.
+func newTruncatingServer(partial, complete string, maxTokens *[]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		*maxTokens = append(*maxTokens, req.MaxTokens)
+		content, finish := partial, "length"
+		if len(*maxTokens) > 1 {
+			content, finish = complete, "stop"
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": content}, "finish_reason": finish}},
+			"usage":   map[string]int{"prompt_tokens": 100, "completion_tokens": 10},
+		})
+	}))
+}
+
+func TestOpenAIClient_RetriesTruncatedAnswer(t *testing.T) {
+	var maxTokens []int
+	srv := newTruncatingServer(`{"answer":"途中`, `{"answer":"完了","confidence":0.7}`, &maxTokens)
+	defer srv.Close()
+
+	c, _ := NewOpenAIClient(srv.URL+"/v1", "", "m", "", true, StaticPrompts(testPrompts()))
+	got, err := c.GenerateAnswer(context.Background(), AnswerInput{Question: "q"})
+	if err != nil {
+		t.Fatalf("GenerateAnswer: %v", err)
+	}
+	if len(maxTokens) != 2 || maxTokens[1] != 2*maxTokens[0] {
+		t.Errorf("expected one retry with a doubled limit, got %v", maxTokens)
+	}
+	if got.Answer != "完了" || got.Usage.PromptTokens != 200 {
+		t.Errorf("expected retried answer with usage of both attempts, got %q / %+v", got.Answer, got.Usage)
+	}
+}
+
+func TestOpenAIClient_RetriesTruncatedRewrite(t *testing.T) {
+	var maxTokens []int
+	srv := newTruncatingServer(`{"q_en":"gate`, `{"q_en":"gate touch penalty"}`, &maxTokens)
+	defer srv.Close()
+
+	c, _ := NewOpenAIClient(srv.URL+"/v1", "", "m", "", true, StaticPrompts(testPrompts()))
+	got, err := c.RewriteQuery(context.Background(), RewriteInput{Question: "q"})
+	if err != nil {
+		t.Fatalf("RewriteQuery: %v", err)
+	}
+	if len(maxTokens) != 2 || maxTokens[0] != rewriteMaxTokens || maxTokens[1] != 2*rewriteMaxTokens {
+		t.Errorf("expected one retry with a doubled limit, got %v", maxTokens)
+	}
+	if got.QueryEN != "gate touch penalty" || got.Usage.PromptTokens != 200 {
+		t.Errorf("expected retried rewrite with usage of both attempts, got %q / %+v", got.QueryEN, got.Usage)
+	}
+}
+
+func TestOpenAIClient_ContentFilter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": ""}, "finish_reason": "content_filter"}},
+		})
+	}))
+	defer srv.Close()
+
+	c, _ := NewOpenAIClient(srv.URL+"/v1", "", "m", "", true, StaticPrompts(testPrompts()))
+	if _, err := c.GenerateAnswer(context.Background(), AnswerInput{Question: "q"}); !errors.Is(err, ErrSafetyBlocked) {
+		t.Errorf("expected ErrSafetyBlocked, got %v", err)
+	}
+}
+
+func TestOpenAIClient_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":{"message":"model loading"}}`))
+	}))
+	defer srv.Close()
+
+	c, _ := NewOpenAIClient(srv.URL+"/v1", "", "m", "", true, StaticPrompts(testPrompts()))
+	if _, err := c.RewriteQuery(context.Background(), RewriteInput{Question: "q"}); err == nil {
+		t.Fatal("expected error for 503 response")
+	}
+}
@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+const (
+	// contextOverheadTokens approximates the JSON keys and metadata serialized
+	// alongside each context's text.
+	contextOverheadTokens = 40
+	// minTruncatedTokens is the smallest remainder worth keeping a truncated
+	// context for; below this the context is dropped instead.
+	minTruncatedTokens = 64
+)
+
+// TokenBudgets holds the context token budget per answer model.
+// A budget <= 0 disables packing.
+type TokenBudgets struct {
+	Default  int
+	PerModel map[string]int
+}
+
+// ParseTokenBudgets parses per-model overrides such as
+// "gemini-2.5-flash=12000,qwen2.5:7b=3000" on top of a default budget.
+func ParseTokenBudgets(defaultBudget int, spec string) (TokenBudgets, error) {
+	b := TokenBudgets{Default: defaultBudget, PerModel: map[string]int{}}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.LastIndex(part, "=")
+		if i <= 0 {
+			return TokenBudgets{}, fmt.Errorf("invalid budget entry %q (want model=tokens)", part)
+		}
+		n, err := strconv.Atoi(part[i+1:])
+		if err != nil {
+			return TokenBudgets{}, fmt.Errorf("invalid budget entry %q: %w", part, err)
+		}
+		b.PerModel[part[:i]] = n
+	}
+	return b, nil
+}
+
+// For returns the budget for model.
+func (b TokenBudgets) For(model string) int {
+	if n, ok := b.PerModel[model]; ok {
+		return n
+	}
+	return b.Default
+}
+
+// EstimateTokens roughly estimates the token count of s: about four ASCII
+// characters per token, and one token per non-ASCII rune (Japanese etc.).
+func EstimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// PackResult is the outcome of PackContexts.
+type PackResult struct {
+	Contexts  []domain.RetrievedContext
+	Dropped   int
+	Truncated int
+}
+
+// Warnings describes what was dropped or truncated, for Meta.Warnings.
+func (p PackResult) Warnings(budget int) []string {
+	var w []string
+	if p.Dropped > 0 {
+		w = append(w, fmt.Sprintf("context_packing: dropped %d context(s) to fit the %d-token budget", p.Dropped, budget))
+	}
+	if p.Truncated > 0 {
+		w = append(w, fmt.Sprintf("context_packing: truncated %d context(s) to fit the %d-token budget", p.Truncated, budget))
+	}
+	return w
+}
+
+// PackContexts orders contexts by score and keeps as many as fit within
+// budget tokens. The first context that does not fit is truncated if a
+// useful remainder is left; everything after it is dropped.
+func PackContexts(contexts []domain.RetrievedContext, budget int) PackResult {
+	sorted := make([]domain.RetrievedContext, len(contexts))
+	copy(sorted, contexts)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Score > sorted[j].Score })
+
+	if budget <= 0 {
+		return PackResult{Contexts: sorted}
+	}
+
+	var res PackResult
+	remaining := budget
+	for i, c := range sorted {
+		cost := EstimateTokens(c.Text) + contextOverheadTokens
+		if cost <= remaining {
+			res.Contexts = append(res.Contexts, c)
+			remaining -= cost
+			continue
+		}
+		if avail := remaining - contextOverheadTokens; avail >= minTruncatedTokens {
+			c.Text = truncateToTokens(c.Text, avail)
+			res.Contexts = append(res.Contexts, c)
+			res.Truncated++
+			res.Dropped += len(sorted) - i - 1
+		} else {
+			res.Dropped += len(sorted) - i
+		}
+		break
+	}
+	return res
+}
+
+// PackParts packs each part's contexts into an equal share of budget, so one
+// sub-question with many long contexts cannot crowd out the others.
+func PackParts(parts []AnswerPart, budget int) ([]AnswerPart, PackResult) {
+	share := budget
+	if budget > 0 && len(parts) > 0 {
+		share = budget / len(parts)
+	}
+	var total PackResult
+	packed := make([]AnswerPart, len(parts))
+	for i, p := range parts {
+		res := PackContexts(p.Contexts, share)
+		packed[i] = AnswerPart{Question: p.Question, Contexts: res.Contexts}
+		total.Contexts = append(total.Contexts, res.Contexts...)
+		total.Dropped += res.Dropped
+		total.Truncated += res.Truncated
+	}
+	return packed, total
+}
+
+// truncateToTokens cuts s so that EstimateTokens(result) <= maxTokens,
+// preferring to end on a whitespace boundary.
+func truncateToTokens(s string, maxTokens int) string {
+	const ellipsis = "..."
+	maxTokens -= EstimateTokens(ellipsis)
+	ascii, other, cut := 0, 0, 0
+	for i, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+		if (ascii+3)/4+other > maxTokens {
+			break
+		}
+		cut = i + utf8.RuneLen(r)
+	}
+	out := s[:cut]
+	if sp := strings.LastIndexAny(out, " \n\t"); sp > len(out)/2 {
+		out = out[:sp]
+	}
+	return strings.TrimSpace(out) + ellipsis
+}
@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	if got := EstimateTokens("abcdefgh"); got != 2 {
+		t.Errorf("expected 2 tokens for 8 ASCII chars, got %d", got)
+	}
+	if got := EstimateTokens("ゲート"); got != 3 {
+		t.Errorf("expected 3 tokens for 3 Japanese runes, got %d", got)
+	}
+}
+
+func TestPackContexts_OrdersAndDrops(t *testing.T) {
+	long := strings.Repeat("word ", 400) // ~500 tokens
+	contexts := []domain.RetrievedContext{
+		{Text: long, Score: 0.5, RuleID: "low"},
+		{Text: long, Score: 0.9, RuleID: "high"},
+		{Text: long, Score: 0.7, RuleID: "mid"},
+	}
+
+	res := PackContexts(contexts, 600)
+	if len(res.Contexts) != 1 || res.Contexts[0].RuleID != "high" {
+		t.Fatalf("expected only the highest-scoring context, got %+v", res.Contexts)
+	}
+	if res.Dropped != 2 || res.Truncated != 0 {
+		t.Errorf("expected 2 dropped and 0 truncated, got %d/%d", res.Dropped, res.Truncated)
+	}
+	if w := res.Warnings(600); len(w) != 1 {
+		t.Errorf("expected one warning, got %v", w)
+	}
+}
+
+func TestPackContexts_TruncatesTail(t *testing.T) {
+	long := strings.Repeat("word ", 400)
+	contexts := []domain.RetrievedContext{
+		{Text: long, Score: 0.9},
+		{Text: long, Score: 0.8},
+	}
+
+	res := PackContexts(contexts, 900)
+	if len(res.Contexts) != 2 || res.Truncated != 1 || res.Dropped != 0 {
+		t.Fatalf("expected second context truncated, got %d contexts, %d truncated, %d dropped", len(res.Contexts), res.Truncated, res.Dropped)
+	}
+	total := 0
+	for _, c := range res.Contexts {
+		total += EstimateTokens(c.Text) + contextOverheadTokens
+	}
+	if total > 900 {
+		t.Errorf("packed contexts exceed budget: %d tokens", total)
+	}
+	if !strings.HasSuffix(res.Contexts[1].Text, "...") {
+		t.Error("expected truncated context to end with ellipsis")
+	}
+}
+
+func TestPackContexts_ZeroBudgetKeepsAll(t *testing.T) {
+	contexts := []domain.RetrievedContext{{Text: "a", Score: 0.1}, {Text: "b", Score: 0.2}}
+	res := PackContexts(contexts, 0)
+	if len(res.Contexts) != 2 || res.Contexts[0].Text != "b" {
+		t.Errorf("expected all contexts ordered by score, got %+v", res.Contexts)
+	}
+}
+
+func TestPackParts_SplitsBudget(t *testing.T) {
+	long := strings.Repeat("word ", 400) // ~500 tokens
+	parts := []AnswerPart{
+		{Question: "a", Contexts: []domain.RetrievedContext{{Text: long, Score: 0.9}, {Text: long, Score: 0.8}}},
+		{Question: "b", Contexts: []domain.RetrievedContext{{Text: "short", Score: 0.7}}},
+	}
+
+	packed, res := PackParts(parts, 1200)
+	if len(packed) != 2 || packed[1].Question != "b" || len(packed[1].Contexts) != 1 {
+		t.Fatalf("expected both parts to keep their question and contexts, got %+v", packed)
+	}
+	if len(packed[0].Contexts) != 1 || res.Dropped != 1 {
+		t.Errorf("expected part a to drop one context within its 600-token share, got %d kept, %d dropped", len(packed[0].Contexts), res.Dropped)
+	}
+}
+
+func TestParseTokenBudgets(t *testing.T) {
+	b, err := ParseTokenBudgets(8000, "gemini-2.5-flash=12000, qwen2.5:7b=3000")
+	if err != nil {
+		t.Fatalf("ParseTokenBudgets: %v", err)
+	}
+	if b.For("qwen2.5:7b") != 3000 || b.For("gemini-2.5-flash") != 12000 || b.For("other") != 8000 {
+		t.Errorf("unexpected budgets: %+v", b)
+	}
+	if _, err := ParseTokenBudgets(0, "nope"); err == nil {
+		t.Error("expected error for malformed entry")
+	}
+}
@@ -1,6 +1,8 @@
 package llm
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"regexp"
@@ -8,46 +10,128 @@ import (
 )
 
 // PromptTemplates holds parsed prompt templates from docs/prompts.md.
+// System prompts take no placeholders and are stored pre-rendered.
 type PromptTemplates struct {
 	RewriteSystem string
-	RewriteUser   string
+	RewriteUser   *Template
 	AnswerSystem  string
-	AnswerUser    string
+	AnswerUser    *Template
+
+	// Optional sections; empty/nil when absent from the file.
+	RewriteHyDEUser     *Template
+	RewriteFollowUpUser *Template
+	DecomposeSystem     string
+	DecomposeUser       *Template
+	AnswerSynthesisUser *Template
+	ClarifySystem       string
+	ClarifyUser         *Template
+	InjectionSystem     string
+	InjectionUser       *Template
+
+	// Version is a short content hash of the prompt file(s), logged with each request.
+	Version string
+	// Variant is the experiment variant these templates belong to; empty outside experiments.
+	Variant string
+}
+
+// promptSection declares a section of the prompt file and the placeholders it may use.
+type promptSection struct {
+	name     string
+	required []string
+	optional []string
+	// optionalSection sections may be absent from the file.
+	optionalSection bool
+}
+
+var promptSections = []promptSection{
+	{name: "query_rewrite_system"},
+	{name: "query_rewrite_user", required: []string{"question", "context_json"}, optional: []string{"question_language"}},
+	{name: "query_rewrite_hyde_user", required: []string{"question", "context_json"}, optional: []string{"question_language"}, optionalSection: true},
+	{name: "query_rewrite_followup_user", required: []string{"question", "context_json", "history_json"}, optional: []string{"question_language"}, optionalSection: true},
+	{name: "answer_system"},
+	{name: "answer_user", required: []string{"question", "answer_language", "contexts_json"}},
+	{name: "answer_synthesis_user", required: []string{"question", "answer_language", "sub_questions_json"}, optionalSection: true},
+	{name: "clarification_system", optionalSection: true},
+	{name: "clarification_user", required: []string{"question", "context_json"}, optional: []string{"question_language"}, optionalSection: true},
+	{name: "question_decompose_system", optionalSection: true},
+	{name: "question_decompose_user", required: []string{"question"}, optional: []string{"question_language"}, optionalSection: true},
+	{name: "injection_classifier_system", optionalSection: true},
+	{name: "injection_classifier_user", required: []string{"question"}, optionalSection: true},
 }
 
 // LoadPrompts parses the prompts.md file and extracts named templates.
 // Expected format: ## template_name followed by a fenced code block.
+// Every known section is validated against its declared placeholders, so a
+// missing or unknown {{placeholder}} fails the load.
 func LoadPrompts(path string) (*PromptTemplates, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read prompts file: %w", err)
 	}
 
-	sections := parsePromptSections(string(data))
+	pt, err := buildPromptTemplates(parsePromptSections(string(data)), path)
+	if err != nil {
+		return nil, err
+	}
+	pt.Version = contentVersion(data)
+	return pt, nil
+}
 
-	get := func(name string) (string, error) {
-		v, ok := sections[name]
+// buildPromptTemplates parses and validates the known sections. source is
+// used in error messages.
+func buildPromptTemplates(sections map[string]string, source string) (*PromptTemplates, error) {
+	tmpls := make(map[string]*Template, len(promptSections))
+	for _, spec := range promptSections {
+		src, ok := sections[spec.name]
 		if !ok {
-			return "", fmt.Errorf("prompt section %q not found in %s", name, path)
+			if spec.optionalSection {
+				continue
+			}
+			return nil, fmt.Errorf("prompt section %q not found in %s", spec.name, source)
 		}
-		return v, nil
+		t, err := ParseTemplate(spec.name, src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		if err := t.Validate(spec.required, spec.optional); err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		tmpls[spec.name] = t
 	}
 
-	pt := &PromptTemplates{}
-	if pt.RewriteSystem, err = get("query_rewrite_system"); err != nil {
-		return nil, err
-	}
-	if pt.RewriteUser, err = get("query_rewrite_user"); err != nil {
-		return nil, err
-	}
-	if pt.AnswerSystem, err = get("answer_system"); err != nil {
-		return nil, err
-	}
-	if pt.AnswerUser, err = get("answer_user"); err != nil {
-		return nil, err
+	system := func(name string) string {
+		t, ok := tmpls[name]
+		if !ok {
+			return ""
+		}
+		s, _ := t.Render(nil) // validated to have no placeholders
+		return s
 	}
 
-	return pt, nil
+	return &PromptTemplates{
+		RewriteSystem:       system("query_rewrite_system"),
+		RewriteUser:         tmpls["query_rewrite_user"],
+		RewriteHyDEUser:     tmpls["query_rewrite_hyde_user"],
+		RewriteFollowUpUser: tmpls["query_rewrite_followup_user"],
+		AnswerSystem:        system("answer_system"),
+		AnswerUser:          tmpls["answer_user"],
+		DecomposeSystem:     system("question_decompose_system"),
+		DecomposeUser:       tmpls["question_decompose_user"],
+		AnswerSynthesisUser: tmpls["answer_synthesis_user"],
+		ClarifySystem:       system("clarification_system"),
+		ClarifyUser:         tmpls["clarification_user"],
+		InjectionSystem:     system("injection_classifier_system"),
+		InjectionUser:       tmpls["injection_classifier_user"],
+	}, nil
+}
+
+// contentVersion returns a short hash of the given file contents.
+func contentVersion(data ...[]byte) string {
+	h := sha256.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
 }
 
 var sectionHeaderRe = regexp.MustCompile(`(?m)^## (.+)$`)
@@ -95,12 +179,3 @@ func extractCodeBlock(text string) string {
 	}
 	return strings.TrimSpace(strings.Join(result, "\n"))
 }
-
-// RenderTemplate replaces {{key}} placeholders in a template string.
-func RenderTemplate(tmpl string, vars map[string]string) string {
-	result := tmpl
-	for k, v := range vars {
-		result = strings.ReplaceAll(result, "{{"+k+"}}", v)
-	}
-	return result
-}
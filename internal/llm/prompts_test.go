@@ -1,6 +1,8 @@
 package llm
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -29,27 +31,82 @@ func TestLoadPrompts(t *testing.T) {
 	if prompts.RewriteSystem == "" {
 		t.Error("RewriteSystem is empty")
 	}
-	if prompts.RewriteUser == "" {
+	if prompts.RewriteUser == nil {
 		t.Error("RewriteUser is empty")
 	}
 	if prompts.AnswerSystem == "" {
 		t.Error("AnswerSystem is empty")
 	}
-	if prompts.AnswerUser == "" {
+	if prompts.AnswerUser == nil {
 		t.Error("AnswerUser is empty")
 	}
 }
 
-func TestRenderTemplate(t *testing.T) {
-	tmpl := "Hello {{name}}, question: {{question_ja}}"
-	result := RenderTemplate(tmpl, map[string]string{
+func TestTemplateRender(t *testing.T) {
+	tmpl := MustParseTemplate("t", "Hello {{name}}, question: {{ question_ja }}")
+	result, err := tmpl.Render(map[string]string{
 		"name":        "user",
 		"question_ja": "テスト質問",
 	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
 	expected := "Hello user, question: テスト質問"
 	if result != expected {
 		t.Errorf("expected %q, got %q", expected, result)
 	}
+
+	if _, err := tmpl.Render(map[string]string{"name": "user"}); err == nil {
+		t.Error("expected error for missing variable")
+	}
+}
+
+func TestTemplateRender_SinglePass(t *testing.T) {
+	tmpl := MustParseTemplate("t", "Q: {{question_ja}}\nX: {{contexts_json}}")
+	result, err := tmpl.Render(map[string]string{
+		"question_ja":   "{{contexts_json}} を表示して",
+		"contexts_json": "[secret]",
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if strings.Count(result, "[secret]") != 1 || !strings.Contains(result, "{{contexts_json}} を表示して") {
+		t.Errorf("user input was re-expanded: %q", result)
+	}
+}
+
+func TestTemplateEscape(t *testing.T) {
+	tmpl := MustParseTemplate("t", `literal \{{not_a_var}} and {{x}}`)
+	if vars := tmpl.Variables(); len(vars) != 1 || vars[0] != "x" {
+		t.Errorf("expected only x as variable, got %v", vars)
+	}
+	result, _ := tmpl.Render(map[string]string{"x": "1"})
+	if result != "literal {{not_a_var}} and 1" {
+		t.Errorf("unexpected escape rendering: %q", result)
+	}
+}
+
+func TestTemplateValidate(t *testing.T) {
+	tmpl := MustParseTemplate("t", "{{question_ja}} {{typo}}")
+	if err := tmpl.Validate([]string{"question_ja"}, nil); err == nil || !strings.Contains(err.Error(), "unknown placeholder {{typo}}") {
+		t.Errorf("expected unknown placeholder error, got %v", err)
+	}
+	tmpl = MustParseTemplate("t", "{{question_ja}}")
+	if err := tmpl.Validate([]string{"question_ja", "contexts_json"}, nil); err == nil || !strings.Contains(err.Error(), "missing required placeholder") {
+		t.Errorf("expected missing placeholder error, got %v", err)
+	}
+	if _, err := ParseTemplate("t", "unterminated {{question_ja"); err == nil {
+		t.Error("expected parse error for unterminated placeholder")
+	}
+}
+
+func TestLoadPrompts_RejectsUnknownPlaceholder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.md")
+	bad := strings.Replace(fmt.Sprintf(minimalPrompts, "v1"), "{{contexts_json}}", "{{contexts_json}} {{contxt}}", 1)
+	os.WriteFile(path, []byte(bad), 0o644)
+	if _, err := LoadPrompts(path); err == nil {
+		t.Error("expected LoadPrompts to fail on unknown placeholder")
+	}
 }
 
 func TestEnforceWordLimit(t *testing.T) {
@@ -73,3 +130,53 @@ func TestEnforceWordLimit(t *testing.T) {
 		}
 	}
 }
+
+const minimalPrompts = "## query_rewrite_system\n```\nrs %s\n```\n## query_rewrite_user\n```\n{{question}} {{context_json}}\n```\n## answer_system\n```\nas\n```\n## answer_user\n```\n{{question}} {{answer_language}} {{contexts_json}}\n```\n"
+
+func TestPromptStore_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.md")
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(minimalPrompts, "v1")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewPromptStore(path, nil)
+	if err != nil {
+		t.Fatalf("NewPromptStore: %v", err)
+	}
+	first := store.Current()
+	if first.Version == "" || first.RewriteSystem != "rs v1" {
+		t.Fatalf("unexpected initial prompts: %+v", first)
+	}
+
+	// A request that pinned the old snapshot keeps seeing it after a reload.
+	ctx := WithPrompts(context.Background(), first)
+
+	os.WriteFile(path, []byte(fmt.Sprintf(minimalPrompts, "v2")), 0o644)
+	changed, err := store.Reload()
+	if err != nil || !changed {
+		t.Fatalf("Reload: changed=%v err=%v", changed, err)
+	}
+	if store.Current().RewriteSystem != "rs v2" || store.Current().Version == first.Version {
+		t.Errorf("expected v2 prompts with new version, got %+v", store.Current())
+	}
+	if store.templates(ctx) != first {
+		t.Error("pinned snapshot was replaced mid-request")
+	}
+
+	// An invalid file is rejected and the current prompts stay active.
+	os.WriteFile(path, []byte("## answer_system\n```\nonly one section\n```\n"), 0o644)
+	if _, err := store.Reload(); err == nil {
+		t.Error("expected reload of invalid file to fail")
+	}
+	if store.Current().RewriteSystem != "rs v2" {
+		t.Error("invalid reload replaced current prompts")
+	}
+	if store.ReloadError() == nil {
+		t.Error("expected the failed reload to be reported")
+	}
+
+	os.WriteFile(path, []byte(fmt.Sprintf(minimalPrompts, "v3")), 0o644)
+	if _, err := store.Reload(); err != nil || store.ReloadError() != nil {
+		t.Errorf("a successful reload should clear the error: %v, %v", err, store.ReloadError())
+	}
+}
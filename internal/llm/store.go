@@ -0,0 +1,158 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PromptStore holds the active prompt set and swaps it atomically on reload.
+// Callers take a snapshot with Current/ForRequest (or via context, see
+// WithPrompts) and use it for the whole request, so a reload never mixes two
+// prompt versions.
+type PromptStore struct {
+	path       string
+	experiment *Experiment
+	current    atomic.Pointer[PromptSet]
+
+	mu        sync.Mutex // serializes reloads
+	modTime   time.Time
+	reloadErr error
+}
+
+// NewPromptStore loads prompts from path. exp may be nil to disable prompt experiments.
+func NewPromptStore(path string, exp *Experiment) (*PromptStore, error) {
+	s := &PromptStore{path: path, experiment: exp}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StaticPrompts wraps fixed templates in a store that cannot be reloaded.
+func StaticPrompts(pt *PromptTemplates) *PromptStore {
+	s := &PromptStore{}
+	s.current.Store(&PromptSet{Base: pt})
+	return s
+}
+
+// Current returns the active base templates.
+func (s *PromptStore) Current() *PromptTemplates {
+	return s.current.Load().Base
+}
+
+// ForRequest returns the templates for the experiment variant assigned to
+// requestID. The assignment is deterministic, so it can be recomputed later
+// (e.g. when feedback for the request arrives).
+func (s *PromptStore) ForRequest(requestID string) *PromptTemplates {
+	return s.current.Load().ForKey(requestID)
+}
+
+// Reload re-reads the prompt files. The new set is validated by
+// LoadPromptSet before it replaces the current one; on error the current set
+// stays active. It reports whether the prompt version changed.
+func (s *PromptStore) Reload() (bool, error) {
+	if s.path == "" {
+		return false, errors.New("prompt store has no backing file")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	modTime, err := s.latestModTime()
+	if err != nil {
+		s.reloadErr = err
+		return false, err
+	}
+	ps, err := LoadPromptSet(s.path, s.experiment)
+	if err != nil {
+		s.reloadErr = err
+		return false, err
+	}
+
+	s.modTime = modTime
+	s.reloadErr = nil
+	old := s.current.Swap(ps)
+	return old == nil || old.Base.Version != ps.Base.Version, nil
+}
+
+// ReloadError returns the error of the last reload, or nil if it succeeded.
+// After a failed reload the previous prompts stay active.
+func (s *PromptStore) ReloadError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reloadErr
+}
+
+// latestModTime returns the newest modification time of the prompt files.
+func (s *PromptStore) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, p := range append([]string{s.path}, s.experiment.files()...) {
+		info, err := os.Stat(p)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("stat prompts file: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Watch polls the prompt files' modification times every interval and
+// reloads on change until ctx is cancelled.
+func (s *PromptStore) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := s.latestModTime()
+		if err != nil {
+			slog.WarnContext(ctx, "prompt watch: stat failed", "path", s.path, "error", err)
+			continue
+		}
+		s.mu.Lock()
+		unchanged := modTime.Equal(s.modTime)
+		s.mu.Unlock()
+		if unchanged {
+			continue
+		}
+
+		changed, err := s.Reload()
+		if err != nil {
+			slog.ErrorContext(ctx, "prompt reload failed; keeping current prompts",
+				"path", s.path, "version", s.Current().Version, "error", err)
+			// Remember the broken files' mtime so they are not retried every tick.
+			s.mu.Lock()
+			s.modTime = modTime
+			s.mu.Unlock()
+			continue
+		}
+		slog.InfoContext(ctx, "prompts reloaded", "path", s.path, "version", s.Current().Version, "changed", changed)
+	}
+}
+
+type promptsKey struct{}
+
+// WithPrompts pins a prompt snapshot to the context for the rest of the request.
+func WithPrompts(ctx context.Context, pt *PromptTemplates) context.Context {
+	return context.WithValue(ctx, promptsKey{}, pt)
+}
+
+// templates returns the snapshot pinned to ctx, or the store's current set.
+func (s *PromptStore) templates(ctx context.Context) *PromptTemplates {
+	if pt, ok := ctx.Value(promptsKey{}).(*PromptTemplates); ok && pt != nil {
+		return pt
+	}
+	return s.Current()
+}
@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var templateVarRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Template is a prompt template with {{name}} placeholders. It is rendered in
+// a single pass, so substituted values are never scanned for placeholders
+// again. A literal "{{" is written as `\{{`.
+type Template struct {
+	name  string
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal  string
+	variable string // empty for literal parts
+}
+
+// ParseTemplate parses src. name is used in error messages only.
+func ParseTemplate(name, src string) (*Template, error) {
+	t := &Template{name: name}
+	var lit strings.Builder
+	for i := 0; i < len(src); {
+		switch {
+		case strings.HasPrefix(src[i:], `\{{`):
+			lit.WriteString("{{")
+			i += 3
+		case strings.HasPrefix(src[i:], "{{"):
+			end := strings.Index(src[i+2:], "}}")
+			if end < 0 {
+				return nil, fmt.Errorf("template %s: unterminated placeholder at offset %d", name, i)
+			}
+			v := strings.TrimSpace(src[i+2 : i+2+end])
+			if !templateVarRe.MatchString(v) {
+				return nil, fmt.Errorf("template %s: invalid placeholder {{%s}}", name, src[i+2:i+2+end])
+			}
+			if lit.Len() > 0 {
+				t.parts = append(t.parts, templatePart{literal: lit.String()})
+				lit.Reset()
+			}
+			t.parts = append(t.parts, templatePart{variable: v})
+			i += 2 + end + 2
+		default:
+			lit.WriteByte(src[i])
+			i++
+		}
+	}
+	if lit.Len() > 0 {
+		t.parts = append(t.parts, templatePart{literal: lit.String()})
+	}
+	return t, nil
+}
+
+// MustParseTemplate is like ParseTemplate but panics on error.
+func MustParseTemplate(name, src string) *Template {
+	t, err := ParseTemplate(name, src)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Variables returns the sorted, de-duplicated placeholder names.
+func (t *Template) Variables() []string {
+	seen := make(map[string]bool)
+	var vars []string
+	for _, p := range t.parts {
+		if p.variable != "" && !seen[p.variable] {
+			seen[p.variable] = true
+			vars = append(vars, p.variable)
+		}
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// Validate checks that every required variable is used and that no
+// placeholder outside required and optional appears.
+func (t *Template) Validate(required, optional []string) error {
+	allowed := make(map[string]bool)
+	for _, v := range append(append([]string{}, required...), optional...) {
+		allowed[v] = true
+	}
+	used := make(map[string]bool)
+	for _, v := range t.Variables() {
+		if !allowed[v] {
+			return fmt.Errorf("template %s: unknown placeholder {{%s}}", t.name, v)
+		}
+		used[v] = true
+	}
+	for _, v := range required {
+		if !used[v] {
+			return fmt.Errorf("template %s: missing required placeholder {{%s}}", t.name, v)
+		}
+	}
+	return nil
+}
+
+// Render substitutes vars in a single pass. Every placeholder in the
+// template must have a value; extra entries in vars are ignored.
+func (t *Template) Render(vars map[string]string) (string, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.variable == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		v, ok := vars[p.variable]
+		if !ok {
+			return "", fmt.Errorf("template %s: no value for {{%s}}", t.name, p.variable)
+		}
+		b.WriteString(v)
+	}
+	return b.String(), nil
+}
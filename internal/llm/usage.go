@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/shunpei/rulegate/internal/domain"
+	"google.golang.org/genai"
+)
+
+// ModelPrice is the list price of a model in USD per million tokens.
+type ModelPrice struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CachedInput float64 `json:"cached_input"`
+}
+
+// PriceTable maps model names to prices.
+type PriceTable map[string]ModelPrice
+
+// ParsePriceTable parses a JSON object such as
+// {"gemini-2.5-flash":{"input":0.30,"output":2.50,"cached_input":0.03}}.
+func ParsePriceTable(s string) (PriceTable, error) {
+	if s == "" {
+		return PriceTable{}, nil
+	}
+	var t PriceTable
+	if err := json.Unmarshal([]byte(s), &t); err != nil {
+		return nil, fmt.Errorf("parse price table: %w", err)
+	}
+	return t, nil
+}
+
+// Cost estimates the USD cost of a single call. Models missing from the
+// table cost zero.
+func (t PriceTable) Cost(u *domain.Usage) float64 {
+	if u == nil {
+		return 0
+	}
+	p, ok := t[u.Model]
+	if !ok {
+		return 0
+	}
+	uncached := u.PromptTokens - u.CachedTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+	output := u.CandidateTokens + u.ThoughtsTokens
+	return (float64(uncached)*p.Input +
+		float64(u.CachedTokens)*p.CachedInput +
+		float64(output)*p.Output) / 1e6
+}
+
+// addUsage sums two usages of the same model; either may be nil.
+func addUsage(a, b *domain.Usage) *domain.Usage {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	sum := *a
+	sum.PromptTokens += b.PromptTokens
+	sum.CandidateTokens += b.CandidateTokens
+	sum.CachedTokens += b.CachedTokens
+	sum.ThoughtsTokens += b.ThoughtsTokens
+	return &sum
+}
+
+func geminiUsage(model string, md *genai.GenerateContentResponseUsageMetadata) *domain.Usage {
+	if md == nil {
+		return nil
+	}
+	return &domain.Usage{
+		Model:           model,
+		PromptTokens:    int(md.PromptTokenCount),
+		CandidateTokens: int(md.CandidatesTokenCount),
+		CachedTokens:    int(md.CachedContentTokenCount),
+		ThoughtsTokens:  int(md.ThoughtsTokenCount),
+	}
+}
+
+// newPromptSize measures a rendered prompt for debug traces.
+func newPromptSize(system, user string) *domain.PromptSize {
+	return &domain.PromptSize{SystemChars: utf8.RuneCountInString(system), UserChars: utf8.RuneCountInString(user)}
+}
@@ -0,0 +1,29 @@
+package llm
+
+import (
+	"math"
+	"testing"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+func TestPriceTable_Cost(t *testing.T) {
+	table, err := ParsePriceTable(`{"m":{"input":1.0,"output":4.0,"cached_input":0.25}}`)
+	if err != nil {
+		t.Fatalf("ParsePriceTable: %v", err)
+	}
+
+	u := &domain.Usage{Model: "m", PromptTokens: 1_000_000, CachedTokens: 400_000, CandidateTokens: 100_000, ThoughtsTokens: 150_000}
+	// 600k uncached * 1.0 + 400k cached * 0.25 + 250k output * 4.0
+	want := 0.6 + 0.1 + 1.0
+	if got := table.Cost(u); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Cost = %f, want %f", got, want)
+	}
+
+	if got := table.Cost(&domain.Usage{Model: "unknown", PromptTokens: 10}); got != 0 {
+		t.Errorf("expected zero cost for unknown model, got %f", got)
+	}
+	if got := table.Cost(nil); got != 0 {
+		t.Errorf("expected zero cost for nil usage, got %f", got)
+	}
+}
@@ -0,0 +1,190 @@
+package llm
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ControlVariant is the variant name that uses the base prompts unchanged.
+const ControlVariant = "control"
+
+// Variant is one arm of a prompt experiment.
+type Variant struct {
+	Name   string
+	Weight int
+	// File optionally points to a prompts file whose sections override the
+	// base sections. Without it, "## <section>@<name>" sections in the base
+	// file provide the overrides.
+	File string
+}
+
+// Experiment splits traffic across prompt variants.
+type Experiment struct {
+	Variants []Variant
+	total    int
+}
+
+// ParseExperiment parses a spec such as "control:70,concise:30" or
+// "control:50,long=docs/prompts_long.md:50". An empty spec disables experiments.
+func ParseExperiment(spec string) (*Experiment, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	e := &Experiment{}
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid variant %q (want name[=file]:weight)", entry)
+		}
+		weight, err := strconv.Atoi(entry[i+1:])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight in variant %q", entry)
+		}
+		name, file, _ := strings.Cut(entry[:i], "=")
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("invalid or duplicate variant name in %q", entry)
+		}
+		seen[name] = true
+		e.Variants = append(e.Variants, Variant{Name: name, Weight: weight, File: file})
+		e.total += weight
+	}
+	if e.total == 0 {
+		return nil, fmt.Errorf("prompt experiment %q has zero total weight", spec)
+	}
+	return e, nil
+}
+
+// Assign deterministically maps key (the request ID) to a variant name.
+func (e *Experiment) Assign(key string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	n := int(h.Sum32() % uint32(e.total))
+	for _, v := range e.Variants {
+		if n < v.Weight {
+			return v.Name
+		}
+		n -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1].Name
+}
+
+// PromptSet is the base prompts plus one resolved template set per variant.
+type PromptSet struct {
+	Base     *PromptTemplates
+	Variants map[string]*PromptTemplates
+
+	experiment *Experiment
+}
+
+// ForKey returns the templates of the variant assigned to key, or the base
+// templates when no experiment is configured.
+func (ps *PromptSet) ForKey(key string) *PromptTemplates {
+	if ps.experiment == nil {
+		return ps.Base
+	}
+	return ps.Variants[ps.experiment.Assign(key)]
+}
+
+// LoadPromptSet loads the base prompts file and every experiment variant.
+// All variants are validated; any error fails the whole load.
+func LoadPromptSet(path string, exp *Experiment) (*PromptSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read prompts file: %w", err)
+	}
+	sections := parsePromptSections(string(data))
+
+	base, err := buildPromptTemplates(sections, path)
+	if err != nil {
+		return nil, err
+	}
+	versionData := [][]byte{data}
+
+	ps := &PromptSet{Base: base, experiment: exp}
+	if exp != nil {
+		ps.Variants = make(map[string]*PromptTemplates, len(exp.Variants))
+		for _, v := range exp.Variants {
+			merged, source, fileData, err := variantSections(sections, path, v)
+			if err != nil {
+				return nil, err
+			}
+			versionData = append(versionData, fileData)
+			pt, err := buildPromptTemplates(merged, source)
+			if err != nil {
+				return nil, err
+			}
+			pt.Variant = v.Name
+			ps.Variants[v.Name] = pt
+		}
+	}
+
+	version := contentVersion(versionData...)
+	base.Version = version
+	for _, pt := range ps.Variants {
+		pt.Version = version
+	}
+	return ps, nil
+}
+
+// variantSections overlays a variant's sections on the base sections.
+func variantSections(base map[string]string, path string, v Variant) (map[string]string, string, []byte, error) {
+	merged := make(map[string]string, len(base))
+	for k, s := range base {
+		if !strings.Contains(k, "@") {
+			merged[k] = s
+		}
+	}
+
+	overrides := 0
+	source := fmt.Sprintf("%s (variant %s)", path, v.Name)
+	var fileData []byte
+	if v.File != "" {
+		data, err := os.ReadFile(v.File)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("read prompt variant %s: %w", v.Name, err)
+		}
+		fileData = data
+		source = fmt.Sprintf("%s (variant %s)", v.File, v.Name)
+		for k, s := range parsePromptSections(string(data)) {
+			if !strings.Contains(k, "@") {
+				merged[k] = s
+				overrides++
+			}
+		}
+	} else {
+		suffix := "@" + v.Name
+		for k, s := range base {
+			if name, ok := strings.CutSuffix(k, suffix); ok {
+				merged[name] = s
+				overrides++
+			}
+		}
+	}
+
+	if overrides == 0 && v.Name != ControlVariant {
+		return nil, "", nil, fmt.Errorf("prompt variant %q overrides no sections (expected \"## <section>@%s\" in %s or a variant file)", v.Name, v.Name, path)
+	}
+	return merged, source, fileData, nil
+}
+
+// files returns the variant files referenced by the experiment.
+func (e *Experiment) files() []string {
+	if e == nil {
+		return nil
+	}
+	var files []string
+	for _, v := range e.Variants {
+		if v.File != "" {
+			files = append(files, v.File)
+		}
+	}
+	return files
+}
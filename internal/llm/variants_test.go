@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseExperiment(t *testing.T) {
+	exp, err := ParseExperiment("control:70, long=docs/long.md:30")
+	if err != nil {
+		t.Fatalf("ParseExperiment: %v", err)
+	}
+	if len(exp.Variants) != 2 || exp.Variants[1] != (Variant{Name: "long", Weight: 30, File: "docs/long.md"}) {
+		t.Errorf("unexpected variants: %+v", exp.Variants)
+	}
+
+	if exp, err := ParseExperiment(""); exp != nil || err != nil {
+		t.Errorf("expected nil experiment for empty spec, got %+v, %v", exp, err)
+	}
+	for _, bad := range []string{"control", "control:x", "control:1,control:1", "a:0,b:0"} {
+		if _, err := ParseExperiment(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestExperimentAssign(t *testing.T) {
+	exp, _ := ParseExperiment("control:75,concise:25")
+
+	counts := map[string]int{}
+	for i := range 4000 {
+		key := fmt.Sprintf("req-%d", i)
+		v := exp.Assign(key)
+		if exp.Assign(key) != v {
+			t.Fatalf("assignment of %q is not deterministic", key)
+		}
+		counts[v]++
+	}
+	if counts["concise"] < 800 || counts["concise"] > 1200 {
+		t.Errorf("expected ~1000 concise assignments, got %v", counts)
+	}
+
+	zero, _ := ParseExperiment("control:1,off:0")
+	for i := range 100 {
+		if v := zero.Assign(fmt.Sprint(i)); v != "control" {
+			t.Fatalf("zero-weight variant was assigned: %q", v)
+		}
+	}
+}
+
+func TestLoadPromptSet_SectionOverrides(t *testing.T) {
+	content := fmt.Sprintf(minimalPrompts, "v1") + "## answer_system@concise\n```\nbe brief\n```\n"
+	path := filepath.Join(t.TempDir(), "prompts.md")
+	os.WriteFile(path, []byte(content), 0o644)
+
+	exp, _ := ParseExperiment("control:50,concise:50")
+	ps, err := LoadPromptSet(path, exp)
+	if err != nil {
+		t.Fatalf("LoadPromptSet: %v", err)
+	}
+	if got := ps.Variants["concise"]; got.AnswerSystem != "be brief" || got.RewriteSystem != "rs v1" || got.Variant != "concise" {
+		t.Errorf("unexpected concise variant: %+v", got)
+	}
+	if got := ps.Variants[ControlVariant]; got.AnswerSystem != "as" {
+		t.Errorf("control should use base sections, got %q", got.AnswerSystem)
+	}
+	if ps.Base.Version != ps.Variants["concise"].Version {
+		t.Error("variants should share the prompt version")
+	}
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if pt := ps.ForKey(key); pt.Variant != exp.Assign(key) {
+			t.Errorf("ForKey(%q) = %q, want %q", key, pt.Variant, exp.Assign(key))
+		}
+	}
+}
+
+func TestLoadPromptSet_VariantFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prompts.md")
+	os.WriteFile(path, []byte(fmt.Sprintf(minimalPrompts, "v1")), 0o644)
+	long := filepath.Join(dir, "long.md")
+	os.WriteFile(long, []byte("## answer_user\n```\nlong {{question}} {{answer_language}} {{contexts_json}}\n```\n"), 0o644)
+
+	exp, _ := ParseExperiment("control:1,long=" + long + ":1")
+	ps, err := LoadPromptSet(path, exp)
+	if err != nil {
+		t.Fatalf("LoadPromptSet: %v", err)
+	}
+	got, _ := ps.Variants["long"].AnswerUser.Render(map[string]string{"question": "q", "answer_language": "English", "contexts_json": "[]"})
+	if got != "long q English []" {
+		t.Errorf("expected variant answer_user, got %q", got)
+	}
+
+	// An invalid variant file fails the whole load.
+	os.WriteFile(long, []byte("## answer_user\n```\n{{question}}\n```\n"), 0o644)
+	if _, err := LoadPromptSet(path, exp); err == nil {
+		t.Error("expected invalid variant to fail the load")
+	}
+}
+
+func TestLoadPromptSet_VariantWithoutOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.md")
+	os.WriteFile(path, []byte(fmt.Sprintf(minimalPrompts, "v1")), 0o644)
+
+	exp, _ := ParseExperiment("control:50,concise:50")
+	_, err := LoadPromptSet(path, exp)
+	if err == nil || !strings.Contains(err.Error(), "concise") {
+		t.Errorf("expected error naming the empty variant, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+func TestValidate_AcceptsValidRequests(t *testing.T) {
+	for _, body := range []string{
+		`{"question":"ゲート接触は？","language":"ja","options":{"top_k":5,"min_confidence":0.6,"retrieval_mode":"hyde"}}`,
+		`{"question_ja":"テスト","context":null,"options":{"decompose":false}}`,
+		`{"question":"q","clarification":{"choices":[{"boat_class":"K1"}]}}`,
+	} {
+		if err := Validate[domain.AskRequest]([]byte(body)); err != nil {
+			t.Errorf("%s: %v", body, err)
+		}
+	}
+	if err := Validate[domain.BatchAskRequest]([]byte(`{"questions":[{"id":"a","question":"q"}]}`)); err != nil {
+		t.Errorf("batch: %v", err)
+	}
+}
+
+func TestValidate_ReportsPreciseErrors(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"question":"q","questoin":"typo"}`, "questoin: unknown field"},
+		{`{"question":"q","options":{"top_k":"5"}}`, "options.top_k: expected integer, got string"},
+		{`{"question":"q","options":{"top_k":5.5}}`, "options.top_k: expected integer, got 5.5"},
+		{`{"question":"q","options":{"retrieval_mode":"bm25"}}`, `options.retrieval_mode: must be one of query, hyde, hyde_fused, got "bm25"`},
+		{`{"question":"q","clarification":{}}`, "clarification.choices: is required"},
+		{`{"question":"q","clarification":{"choices":[{"boat":"K1"}]}}`, "clarification.choices[0].boat: unknown field"},
+		{`{"question":1}`, "question: expected string, got number"},
+		{`{"question":null}`, "question: must not be null"},
+		{`["q"]`, "expected object, got array"},
+		{`{"question":"q"} {}`, "invalid JSON: unexpected data after the body"},
+	}
+	for _, tt := range tests {
+		err := Validate[domain.AskRequest]([]byte(tt.body))
+		var verr *ValidationError
+		if !errors.As(err, &verr) || err.Error() != tt.want {
+			t.Errorf("%s: got %v, want %q", tt.body, err, tt.want)
+		}
+	}
+
+	err := Validate[domain.BatchAskRequest]([]byte(`{"questions":[{"question":"a"},{"question":2}]}`))
+	if err == nil || err.Error() != "questions[1].question: expected string, got number" {
+		t.Errorf("batch: got %v", err)
+	}
+}
+
+func TestSpec_IsValidJSON(t *testing.T) {
+	b, err := json.Marshal(Spec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range refRe.FindAllStringSubmatch(string(b), -1) {
+		if _, ok := Spec().Components.Schemas[ref[1]]; !ok {
+			t.Errorf("dangling reference to %s", ref[1])
+		}
+	}
+}
+
+// TestFrontendTypesMatchSchema keeps frontend/src/lib/types.ts in step with
+// the current (not v1) schemas: every component they reference needs an
+// interface of the same name with the same fields, optional exactly when not
+// required.
+func TestFrontendTypesMatchSchema(t *testing.T) {
+	src, err := os.ReadFile("../../frontend/src/lib/types.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interfaces := parseInterfaces(string(src))
+
+	var current []any
+	for path, ops := range Spec().Paths {
+		for _, op := range ops {
+			if !strings.HasPrefix(path, "/api/v1/") && !op.Deprecated {
+				current = append(current, op)
+			}
+		}
+	}
+	for _, name := range referenced(t, current...) {
+		s := Spec().Components.Schemas[name]
+		fields, ok := interfaces[name]
+		if !ok {
+			t.Errorf("types.ts: missing interface %s", name)
+			continue
+		}
+		for prop := range s.Properties {
+			optional, ok := fields[prop]
+			switch {
+			case !ok:
+				t.Errorf("types.ts: %s is missing %s", name, prop)
+			case optional == slices.Contains(s.Required, prop):
+				t.Errorf("types.ts: %s.%s optional=%v, but required=%v in the schema", name, prop, optional, !optional)
+			}
+		}
+		for _, prop := range slices.Sorted(maps.Keys(fields)) {
+			if _, ok := s.Properties[prop]; !ok {
+				t.Errorf("types.ts: %s.%s is not in the schema", name, prop)
+			}
+		}
+	}
+}
+
+// TestV1SchemaFrozen fails when a field of the /api/v1 response contract is
+// added, removed or renamed. New fields belong on the v2 types.
+func TestV1SchemaFrozen(t *testing.T) {
+	frozen := map[string]string{
+		"AskResponseV1":           "answer answer_ja citations confidence contexts conversation_id debug language meta",
+		"CitationV1":              "quote_en rule_id score section_title source_url sub_question",
+		"MetaV1":                  "answer_model rag_corpus rewrite_model sub_questions top_k usage warnings",
+		"ClarificationResponseV1": "clarification conversation_id debug language meta question",
+		"BatchAskResponseV1":      "meta results",
+		"BatchItemResultV1":       "clarification error id index response status",
+	}
+	for name, want := range frozen {
+		s, ok := Spec().Components.Schemas[name]
+		if !ok {
+			t.Errorf("missing component %s", name)
+			continue
+		}
+		if got := strings.Join(slices.Sorted(maps.Keys(s.Properties)), " "); got != want {
+			t.Errorf("%s fields changed:\n got: %s\nwant: %s", name, got, want)
+		}
+	}
+}
+
+var refRe = regexp.MustCompile(`"\$ref":"#/components/schemas/(\w+)"`)
+
+// referenced returns the components reachable from roots, sorted.
+func referenced(t *testing.T, roots ...any) []string {
+	t.Helper()
+	seen := map[string]bool{}
+	queue := roots
+	for len(queue) > 0 {
+		b, err := json.Marshal(queue[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		queue = queue[1:]
+		for _, m := range refRe.FindAllStringSubmatch(string(b), -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				queue = append(queue, Spec().Components.Schemas[m[1]])
+			}
+		}
+	}
+	return slices.Sorted(maps.Keys(seen))
+}
+
+var (
+	interfaceRe = regexp.MustCompile(`(?m)^export interface (\w+) \{$`)
+	fieldRe     = regexp.MustCompile(`^  (\w+)(\??): `)
+)
+
+// parseInterfaces returns each exported interface's top-level fields and
+// whether they are optional.
+func parseInterfaces(src string) map[string]map[string]bool {
+	out := map[string]map[string]bool{}
+	for _, m := range interfaceRe.FindAllStringSubmatchIndex(src, -1) {
+		name := src[m[2]:m[3]]
+		body, _, _ := strings.Cut(src[m[1]:], "\n}")
+		fields := map[string]bool{}
+		for line := range strings.SplitSeq(body, "\n") {
+			if f := fieldRe.FindStringSubmatch(line); f != nil {
+				fields[f[1]] = f[2] == "?"
+			}
+		}
+		out[name] = fields
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+// Package openapi describes the public HTTP API as an OpenAPI 3 document
+// generated from the domain structs, and validates request bodies against
+// the same schemas, so the served contract and the accepted input cannot
+// drift apart.
+package openapi
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// Schema is the subset of the OpenAPI 3.0 schema object the generator emits.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+const refPrefix = "#/components/schemas/"
+
+// enums lists the values of string types that are parsed strictly. Language
+// is not listed: it also accepts forms such as "EN" and "ko-KR".
+var enums = map[reflect.Type][]string{
+	reflect.TypeFor[domain.FeedbackRating](): {
+		string(domain.RatingHelpful), string(domain.RatingWrong), string(domain.RatingIncomplete),
+	},
+	reflect.TypeFor[domain.HealthStatus](): {
+		string(domain.HealthOK), string(domain.HealthDegraded), string(domain.HealthUnavailable),
+	},
+	reflect.TypeFor[domain.RetrievalMode](): {
+		string(domain.RetrievalQuery), string(domain.RetrievalHyDE), string(domain.RetrievalHyDEFused),
+	},
+}
+
+var descriptions = map[reflect.Type]string{
+	reflect.TypeFor[domain.Language](): "ISO 639-1 code: ja, en or ko",
+}
+
+// generator builds schemas, registering every struct type as a component.
+type generator struct {
+	components map[string]*Schema
+}
+
+// ref returns a reference to the component for struct type t, generating
+// it on first use.
+func (g *generator) ref(t reflect.Type) *Schema {
+	name := t.Name()
+	if _, ok := g.components[name]; !ok {
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+		// Register before walking the fields so recursive types terminate.
+		g.components[name] = s
+		g.fields(s, t)
+	}
+	return &Schema{Ref: refPrefix + name}
+}
+
+func (g *generator) fields(s *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			g.fields(s, f.Type)
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func (g *generator) schema(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.schema(t.Elem())
+		if s.Ref != "" {
+			// A $ref cannot carry siblings in OpenAPI 3.0.
+			return &Schema{OneOf: []*Schema{s}, Nullable: true}
+		}
+		s.Nullable = true
+		return s
+	case reflect.Struct:
+		return g.ref(t)
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string", Enum: enums[t], Description: descriptions[t]}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	}
+	return &Schema{}
+}
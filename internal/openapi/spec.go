@@ -0,0 +1,170 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// Document is an OpenAPI 3.0 document.
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Version is the API version reported in the document.
+const Version = "2.0.0"
+
+// Spec returns the API document. It is generated once and must not be
+// modified.
+var Spec = sync.OnceValue(build)
+
+func build() *Document {
+	g := &generator{components: map[string]*Schema{}}
+	errorResp := g.ref(reflect.TypeFor[domain.ErrorResponse]())
+	errors := func(statuses ...int) map[string]*Response {
+		rs := map[string]*Response{}
+		for _, status := range statuses {
+			rs[strconv.Itoa(status)] = jsonResponse(http.StatusText(status), errorResp)
+		}
+		return rs
+	}
+	withOK := func(ok *Response, rs map[string]*Response) map[string]*Response {
+		rs["200"] = ok
+		return rs
+	}
+
+	// ask and askBatch describe the ask operations of one API version by
+	// the types its responses are rendered as.
+	ask := func(id string, answer, clarification reflect.Type) *Operation {
+		return &Operation{
+			OperationID: id,
+			Summary:     "Answer a rules question, or ask a clarifying question",
+			RequestBody: jsonBody(g.ref(reflect.TypeFor[domain.AskRequest]())),
+			Responses: withOK(
+				jsonResponse("An answer (possibly \"not found\") or a clarification request", &Schema{OneOf: []*Schema{
+					g.ref(answer), g.ref(clarification),
+				}}),
+				errors(http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity,
+					http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway),
+			),
+		}
+	}
+	askBatch := func(id string, batch reflect.Type) *Operation {
+		return &Operation{
+			OperationID: id,
+			Summary:     "Answer several questions; failures are reported per item",
+			RequestBody: jsonBody(g.ref(reflect.TypeFor[domain.BatchAskRequest]())),
+			Responses: withOK(
+				jsonResponse("One result per question, in request order", g.ref(batch)),
+				errors(http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge,
+					http.StatusTooManyRequests, http.StatusInternalServerError),
+			),
+		}
+	}
+	deprecated := func(op *Operation) *Operation {
+		op.Summary += " (unversioned alias of /api/v1)"
+		op.Deprecated = true
+		return op
+	}
+
+	v1Ask, v1Clarification, v1Batch := reflect.TypeFor[domain.AskResponseV1](), reflect.TypeFor[domain.ClarificationResponseV1](), reflect.TypeFor[domain.BatchAskResponseV1]()
+	v2Ask, v2Clarification, v2Batch := reflect.TypeFor[domain.AskResponse](), reflect.TypeFor[domain.ClarificationResponse](), reflect.TypeFor[domain.BatchAskResponse]()
+
+	return &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "rulegate API",
+			Description: "Answers questions about canoe slalom rules from the ICF rule book. /api/v1 is frozen; new fields are added to /api/v2 only.",
+			Version:     Version,
+		},
+		Paths: map[string]map[string]*Operation{
+			"/healthz": {"get": {
+				OperationID: "healthz",
+				Summary:     "Health check",
+				Responses: map[string]*Response{"200": jsonResponse("OK", &Schema{
+					Type:       "object",
+					Properties: map[string]*Schema{"status": {Type: "string"}},
+					Required:   []string{"status"},
+				})},
+			}},
+			"/readyz": {"get": {
+				OperationID: "readyz",
+				Summary:     "Readiness check of the retriever, LLM and prompts (cached for a few seconds)",
+				Responses: map[string]*Response{
+					"200": jsonResponse("Ready (status ok or degraded)", g.ref(reflect.TypeFor[domain.ReadinessResponse]())),
+					"503": jsonResponse("A dependency is unavailable", g.ref(reflect.TypeFor[domain.ReadinessResponse]())),
+				},
+			}},
+			"/api/v1/ask":       {"post": ask("askV1", v1Ask, v1Clarification)},
+			"/api/v1/ask/batch": {"post": askBatch("askBatchV1", v1Batch)},
+			"/api/v2/ask":       {"post": ask("askV2", v2Ask, v2Clarification)},
+			"/api/v2/ask/batch": {"post": askBatch("askBatchV2", v2Batch)},
+			"/api/ask":          {"post": deprecated(ask("ask", v1Ask, v1Clarification))},
+			"/api/ask/batch":    {"post": deprecated(askBatch("askBatch", v1Batch))},
+			"/api/feedback": {"post": {
+				OperationID: "feedback",
+				Summary:     "Rate an earlier answer by its X-Request-ID (only when a feedback store is configured)",
+				RequestBody: jsonBody(g.ref(reflect.TypeFor[domain.FeedbackRequest]())),
+				Responses: map[string]*Response{
+					"201": jsonResponse("Stored", g.ref(reflect.TypeFor[domain.FeedbackResponse]())),
+					"400": jsonResponse(http.StatusText(http.StatusBadRequest), errorResp),
+					"413": jsonResponse(http.StatusText(http.StatusRequestEntityTooLarge), errorResp),
+					"429": jsonResponse(http.StatusText(http.StatusTooManyRequests), errorResp),
+					"500": jsonResponse(http.StatusText(http.StatusInternalServerError), errorResp),
+				},
+			}},
+			"/api/openapi.json": {"get": {
+				OperationID: "openapi",
+				Summary:     "This document",
+				Responses:   map[string]*Response{"200": jsonResponse("OK", &Schema{Type: "object"})},
+			}},
+		},
+		Components: Components{Schemas: g.components},
+	}
+}
+
+func jsonBody(s *Schema) *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {Schema: s}}}
+}
+
+func jsonResponse(desc string, s *Schema) *Response {
+	return &Response{Description: desc, Content: map[string]MediaType{"application/json": {Schema: s}}}
+}
@@ -0,0 +1,161 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ValidationError reports the first place a body does not match its schema.
+// Path is a JSON path such as "questions[1].question"; empty for the body
+// itself.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks that body is a single JSON value matching the schema of
+// the request type T: no unknown fields, the right JSON types, required
+// fields present and enum values known. Semantic checks (lengths, mutually
+// exclusive fields) are left to the domain types.
+func Validate[T any](body []byte) error {
+	t := reflect.TypeFor[T]()
+	s, ok := Spec().Components.Schemas[t.Name()]
+	if !ok {
+		return fmt.Errorf("openapi: no schema for %s", t)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return &ValidationError{Message: "invalid JSON: " + err.Error()}
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return &ValidationError{Message: "invalid JSON: unexpected data after the body"}
+	}
+	return validate("", s, v)
+}
+
+func validate(path string, s *Schema, v any) error {
+	s = resolve(s)
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return &ValidationError{Path: path, Message: "must not be null"}
+	}
+	if s.Type == "" && len(s.OneOf) == 1 {
+		// A nullable $ref; null was handled above.
+		return validate(path, s.OneOf[0], v)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return typeError(path, s.Type, v)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return &ValidationError{Path: join(path, name), Message: "is required"}
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(obj)) {
+			prop, ok := s.Properties[name]
+			if !ok {
+				extra, _ := s.AdditionalProperties.(*Schema)
+				if extra == nil {
+					return &ValidationError{Path: join(path, name), Message: "unknown field"}
+				}
+				prop = extra
+			}
+			if err := validate(join(path, name), prop, obj[name]); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return typeError(path, s.Type, v)
+		}
+		for i, item := range arr {
+			if err := validate(path+"["+strconv.Itoa(i)+"]", s.Items, item); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return typeError(path, s.Type, v)
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be one of %s, got %q", strings.Join(s.Enum, ", "), str)}
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return typeError(path, s.Type, v)
+		}
+		if _, err := strconv.ParseInt(n.String(), 10, 64); err != nil {
+			return &ValidationError{Path: path, Message: "expected integer, got " + n.String()}
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return typeError(path, s.Type, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return typeError(path, s.Type, v)
+		}
+	}
+	return nil
+}
+
+func resolve(s *Schema) *Schema {
+	for s.Ref != "" {
+		s = Spec().Components.Schemas[strings.TrimPrefix(s.Ref, refPrefix)]
+	}
+	return s
+}
+
+func typeError(path, want string, v any) error {
+	return &ValidationError{Path: path, Message: fmt.Sprintf("expected %s, got %s", want, jsonType(v))}
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
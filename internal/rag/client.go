@@ -2,25 +2,41 @@ package rag
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 
 	aiplatform "cloud.google.com/go/aiplatform/apiv1"
 	aiplatformpb "cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
 	"github.com/shunpei/rulegate/internal/domain"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
 // Retriever abstracts RAG context retrieval for testability.
 type Retriever interface {
 	RetrieveContexts(ctx context.Context, query string, corpusID string, topK int) ([]domain.RetrievedContext, error)
+	// HealthCheck makes a cheap call that fails when the backend is
+	// unreachable or the credentials do not work.
+	HealthCheck(ctx context.Context) error
 	Close() error
 }
 
+// CorpusVersioner is implemented by retrievers that can tell when a corpus
+// changed. The version is opaque; it changes whenever files are imported,
+// updated or deleted.
+type CorpusVersioner interface {
+	CorpusVersion(ctx context.Context, corpusID string) (string, error)
+}
+
 // VertexRAGClient implements Retriever using Vertex AI RAG Engine.
 type VertexRAGClient struct {
 	client    *aiplatform.VertexRagClient
+	data      *aiplatform.VertexRagDataClient
 	projectID string
 	region    string
 }
@@ -32,8 +48,14 @@ func NewVertexRAGClient(ctx context.Context, projectID, region string) (*VertexR
 	if err != nil {
 		return nil, fmt.Errorf("create vertex rag client: %w", err)
 	}
+	data, err := aiplatform.NewVertexRagDataClient(ctx, option.WithEndpoint(endpoint))
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("create vertex rag data client: %w", err)
+	}
 	return &VertexRAGClient{
 		client:    client,
+		data:      data,
 		projectID: projectID,
 		region:    region,
 	}, nil
@@ -93,8 +115,39 @@ func (c *VertexRAGClient) RetrieveContexts(ctx context.Context, query string, co
 	return results, nil
 }
 
+// HealthCheck lists at most one corpus of the project.
+func (c *VertexRAGClient) HealthCheck(ctx context.Context) error {
+	it := c.data.ListRagCorpora(ctx, &aiplatformpb.ListRagCorporaRequest{
+		Parent:   fmt.Sprintf("projects/%s/locations/%s", c.projectID, c.region),
+		PageSize: 1,
+	})
+	if _, err := it.Next(); err != nil && !errors.Is(err, iterator.Done) {
+		return fmt.Errorf("list rag corpora: %w", err)
+	}
+	return nil
+}
+
+// CorpusVersion hashes the names and update times of the corpus files.
+func (c *VertexRAGClient) CorpusVersion(ctx context.Context, corpusID string) (string, error) {
+	var files []string
+	it := c.data.ListRagFiles(ctx, &aiplatformpb.ListRagFilesRequest{Parent: corpusID})
+	for {
+		f, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("list rag files: %w", err)
+		}
+		files = append(files, fmt.Sprintf("%s %d", f.GetName(), f.GetUpdateTime().AsTime().UnixNano()))
+	}
+	slices.Sort(files)
+	sum := sha256.Sum256([]byte(strings.Join(files, "\n")))
+	return hex.EncodeToString(sum[:6]), nil
+}
+
 func (c *VertexRAGClient) Close() error {
-	return c.client.Close()
+	return errors.Join(c.client.Close(), c.data.Close())
 }
 
 // CorpusName builds the corpus resource name from discipline and rule edition.
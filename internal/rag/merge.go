@@ -0,0 +1,34 @@
+package rag
+
+import (
+	"sort"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// MergeContexts fuses the results of several retrievals for the same
+// question. Chunks returned by more than one query are kept once with their
+// highest score; the result is sorted by score and capped at topK.
+func MergeContexts(topK int, results ...[]domain.RetrievedContext) []domain.RetrievedContext {
+	type key struct{ source, text string }
+	index := make(map[key]int)
+	var merged []domain.RetrievedContext
+	for _, contexts := range results {
+		for _, c := range contexts {
+			k := key{c.SourceURI, c.Text}
+			if i, ok := index[k]; ok {
+				if c.Score > merged[i].Score {
+					merged[i].Score, merged[i].RawScore = c.Score, c.RawScore
+				}
+				continue
+			}
+			index[k] = len(merged)
+			merged = append(merged, c)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Score > merged[j].Score })
+	if topK > 0 && len(merged) > topK {
+		merged = merged[:topK]
+	}
+	return merged
+}
@@ -0,0 +1,50 @@
+package rag
+
+import (
+	"fmt"
+
+	"github.com/shunpei/rulegate/internal/domain"
+)
+
+// ScoreMetric names what the retriever's raw scores measure, which depends
+// on the vector database and its distance measure.
+type ScoreMetric string
+
+const (
+	// MetricSimilarity scores are similarities, higher meaning more relevant.
+	MetricSimilarity ScoreMetric = "similarity"
+	// MetricCosineDistance scores are cosine distances in [0, 2], lower
+	// meaning more relevant.
+	MetricCosineDistance ScoreMetric = "cosine_distance"
+)
+
+// ParseScoreMetric validates a score metric name.
+func ParseScoreMetric(s string) (ScoreMetric, error) {
+	switch m := ScoreMetric(s); m {
+	case MetricSimilarity, MetricCosineDistance:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown score metric %q (want similarity or cosine_distance)", s)
+}
+
+// Calibrate maps a raw score to a relevance in [0, 1], higher meaning more
+// relevant, which is what the confidence gate compares with min_confidence.
+// An empty metric means MetricSimilarity.
+func (m ScoreMetric) Calibrate(raw float64) float64 {
+	if m == MetricCosineDistance {
+		raw = 1 - raw
+	}
+	return min(max(raw, 0), 1)
+}
+
+// CalibrateContexts returns copies of cs with the retriever's score moved to
+// RawScore and Score calibrated.
+func (m ScoreMetric) CalibrateContexts(cs []domain.RetrievedContext) []domain.RetrievedContext {
+	out := make([]domain.RetrievedContext, len(cs))
+	for i, c := range cs {
+		c.RawScore = c.Score
+		c.Score = m.Calibrate(c.Score)
+		out[i] = c
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+# Build the API image and check that it starts with the SQLite conversation
+# and feedback stores, replaying a recorded cassette instead of calling
+# Vertex AI.
+# Usage: ./scripts/smoke_image.sh
+
+IMAGE="rulegate-api:smoke"
+NAME="rulegate-api-smoke"
+PORT="${PORT:-18080}"
+
+echo "==> Building container image..."
+docker build -t "${IMAGE}" .
+
+cleanup() { docker rm -f "${NAME}" >/dev/null 2>&1 || true; }
+trap cleanup EXIT
+
+echo "==> Starting container..."
+docker run -d --name "${NAME}" -p "${PORT}:8080" \
+  -v "$(pwd)/internal/http/testdata/cassettes:/cassettes:ro" \
+  -e CASSETTE_REPLAY=/cassettes/gate_touch.jsonl \
+  -e RAG_CORPUS_ID=projects/test/locations/us-central1/ragCorpora/test \
+  -e PROMPTS_PATH=/docs/prompts.md \
+  -e CONVERSATION_STORE=sqlite \
+  -e CONVERSATION_SQLITE_PATH=/tmp/conversations.db \
+  -e FEEDBACK_STORE=sqlite \
+  -e FEEDBACK_PATH=/tmp/feedback.db \
+  "${IMAGE}" >/dev/null
+
+echo "==> Waiting for /readyz..."
+for _ in $(seq 1 30); do
+  if READY=$(curl -fsS "http://localhost:${PORT}/readyz" 2>/dev/null); then
+    break
+  fi
+  if [ "$(docker inspect -f '{{.State.Running}}' "${NAME}")" != "true" ]; then
+    docker logs "${NAME}"
+    echo "Container exited during startup"
+    exit 1
+  fi
+  sleep 1
+done
+if [ -z "${READY:-}" ]; then
+  docker logs "${NAME}"
+  echo "/readyz did not become ready"
+  exit 1
+fi
+
+echo "==> Writing feedback to the SQLite store..."
+STATUS=$(curl -sS -o /dev/null -w '%{http_code}' -X POST "http://localhost:${PORT}/api/feedback" \
+  -H 'Content-Type: application/json' \
+  -d '{"request_id":"smoke-1","rating":"helpful"}')
+if [ "${STATUS}" != "201" ]; then
+  docker logs "${NAME}"
+  echo "POST /api/feedback returned ${STATUS}"
+  exit 1
+fi
+
+echo "==> Image OK"